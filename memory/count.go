@@ -0,0 +1,60 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/gosuri/go-store/store"
+)
+
+// Count returns the number of items of the type of sample, an item or a
+// slice of items, that have not expired.
+func (s *Store) Count(sample interface{}) (int, error) {
+	t, err := store.ItemType(sample)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	s.data.mu.RLock()
+	defer s.data.mu.RUnlock()
+	var count int
+	for _, rec := range s.data.collections[s.typeName(t)] {
+		if rec.live(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Exists reports whether the item is stored and has not expired. When the
+// key is empty, it returns a store.ErrEmptyKey error.
+func (s *Store) Exists(i store.Item) (bool, error) {
+	exists, err := s.ExistsMultiple([]store.Item{i})
+	if err != nil {
+		return false, err
+	}
+	return exists[0], nil
+}
+
+// ExistsMultiple reports whether each of the items is stored. Like Exists,
+// it expects the keys of the items to be set.
+func (s *Store) ExistsMultiple(items []store.Item) ([]bool, error) {
+	for _, i := range items {
+		if err := validate(i); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	s.data.mu.RLock()
+	defer s.data.mu.RUnlock()
+	exists := make([]bool, len(items))
+	for n, i := range items {
+		rec := s.data.collections[s.typeName(reflect.TypeOf(i).Elem())][i.Key()]
+		exists[n] = rec.live(now)
+	}
+	return exists, nil
+}
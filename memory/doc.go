@@ -0,0 +1,6 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package memory is the in-process implementation for store. It keeps items in memory and is suitable as a test double and a local development backend.
+package memory
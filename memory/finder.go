@@ -0,0 +1,88 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/gosuri/go-store/store"
+)
+
+// FindBy populates the slice dst with the items whose indexed field equals
+// value. The items are ordered by key.
+func (s *Store) FindBy(field string, value interface{}, dst interface{}) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	x, err := store.LookupIndex(sl.Type(), field)
+	if err != nil {
+		return err
+	}
+	b, err := x.Encode(value)
+	if err != nil {
+		return err
+	}
+	keys := s.find(s.typeName(sl.Type()), func(key string, rec *record) bool {
+		val, ok := rec.fields[x.Field]
+		return ok && bytes.Equal(val, b)
+	})
+	if err := sl.SetKeys(keys); err != nil {
+		return err
+	}
+	return sl.RemoveNotFound(s.readMultiple(sl, nil))
+}
+
+// FindRange populates the slice dst with the items whose numeric indexed
+// field is between min and max inclusive. The items are ordered by the
+// field value.
+func (s *Store) FindRange(field string, min, max float64, dst interface{}) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	x, err := store.LookupIndex(sl.Type(), field)
+	if err != nil {
+		return err
+	}
+	if !x.Numeric {
+		return store.ErrNotIndexed
+	}
+
+	scores := make(map[string]float64)
+	keys := s.find(s.typeName(sl.Type()), func(key string, rec *record) bool {
+		score, err := x.Score(rec.fields[x.Field])
+		if err != nil || score < min || score > max {
+			return false
+		}
+		scores[key] = score
+		return true
+	})
+	sort.SliceStable(keys, func(a, b int) bool {
+		return scores[keys[a]] < scores[keys[b]]
+	})
+	if err := sl.SetKeys(keys); err != nil {
+		return err
+	}
+	return sl.RemoveNotFound(s.readMultiple(sl, nil))
+}
+
+// find is a helper function that returns the sorted keys of the live
+// records in the collection that match
+func (s *Store) find(name string, match func(key string, rec *record) bool) []string {
+	now := time.Now()
+	s.data.mu.RLock()
+	defer s.data.mu.RUnlock()
+	var keys []string
+	for key, rec := range s.data.collections[name] {
+		if rec.live(now) && match(key, rec) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
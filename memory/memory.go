@@ -0,0 +1,530 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gosuri/go-store/store"
+)
+
+// record is an item kept in memory
+type record struct {
+	// fields is the encoded item, as returned by store.Marshal
+	fields map[string][]byte
+	// expires is the time the record expires, it never expires when zero
+	expires time.Time
+	// version is incremented on each write of items that implement
+	// store.Versioner
+	version int64
+	// created is the time the item was first written, it is kept when the
+	// item is written again
+	created time.Time
+}
+
+// live reports whether the record exists and has not expired at now.
+// Expired records are removed lazily, when they are found by a read.
+func (r *record) live(now time.Time) bool {
+	return r != nil && (r.expires.IsZero() || now.Before(r.expires))
+}
+
+// copyTo copies the fields of the record to the item i, or all of its
+// fields when fields is empty, along with its remaining time to live and
+// version for items that implement store.TTLSetter and store.Versioner
+func (r *record) copyTo(i store.Item, now time.Time, fields []store.Field) error {
+	var err error
+	if len(fields) > 0 {
+		err = store.UnmarshalFields(r.fields, i, fields)
+	} else {
+		err = store.Unmarshal(r.fields, i)
+	}
+	if err != nil {
+		return err
+	}
+	if t, ok := i.(store.TTLSetter); ok {
+		t.SetTTL(r.ttl(now))
+	}
+	if v, ok := i.(store.Versioner); ok {
+		v.SetVersion(r.version)
+	}
+	return nil
+}
+
+// ttl returns the remaining time to live of the record at now, or zero
+// when it doesn't expire
+func (r *record) ttl(now time.Time) time.Duration {
+	if r.expires.IsZero() {
+		return 0
+	}
+	return r.expires.Sub(now)
+}
+
+// data is the item data shared by stores in different namespaces. Records are
+// grouped by collection, the type name prefixed with the namespace.
+type data struct {
+	mu          sync.RWMutex
+	collections map[string]map[string]*record
+}
+
+// Store implements the store.Store methods in memory. It is safe for
+// concurrent use by multiple goroutines.
+type Store struct {
+	data      *data
+	namespace string
+}
+
+// New returns a new empty Store that keeps its items in namespace.
+func New(namespace string) *Store {
+	return &Store{
+		data:      &data{collections: make(map[string]map[string]*record)},
+		namespace: namespace,
+	}
+}
+
+// WithNamespace returns a Store that shares the items of s but keeps its
+// items in namespace, the same way redis stores with different namespaces
+// share a database.
+func (s *Store) WithNamespace(namespace string) *Store {
+	return &Store{data: s.data, namespace: namespace}
+}
+
+// Read reads the item from the store and copies the values to item. It
+// returns store.ErrKeyNotFound when no values are found for the key provided
+// and store.ErrEmptyKey when key is not provided. The remaining time to live
+// is set on items that implement store.TTLSetter.
+func (s *Store) Read(i store.Item) error {
+	return s.read(i, nil)
+}
+
+// ReadFields reads only the fields named of the item, by their Go name or the
+// name they are stored under, and leaves its other fields untouched. It
+// returns store.ErrUnknownField when the item has no such field, and like
+// Read, store.ErrKeyNotFound when no item is stored for the key.
+func (s *Store) ReadFields(i store.Item, fields ...string) error {
+	projected, err := lookupFields(reflect.TypeOf(i), fields)
+	if err != nil {
+		return err
+	}
+	return s.read(i, projected)
+}
+
+// read is a helper function that reads the fields of the item, or all of
+// its fields when fields is empty
+func (s *Store) read(i store.Item, fields []store.Field) error {
+	if err := validate(i); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := s.typeName(reflect.TypeOf(i).Elem())
+	s.data.mu.RLock()
+	rec := s.data.collections[name][i.Key()]
+	s.data.mu.RUnlock()
+	if !rec.live(now) {
+		if rec != nil {
+			s.purge(name, i.Key())
+		}
+		return store.ErrKeyNotFound
+	}
+	return rec.copyTo(i, now, fields)
+}
+
+// ReadMultiple reads the items in the slice i from the store. Like Read, it
+// expects the keys of the items to be set. It returns a store.MultiError with
+// the items that are not found, have invalid keys or fail to convert, which
+// are reset to their zero value.
+func (s *Store) ReadMultiple(i interface{}) error {
+	return s.ReadMultipleFields(i)
+}
+
+// ReadMultipleFields is like ReadMultiple but reads only the fields named of
+// the items as ReadFields does, leaving their other fields untouched. Items
+// that fail are left untouched as well.
+func (s *Store) ReadMultipleFields(dst interface{}, fields ...string) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	projected, err := lookupFields(sl.Type(), fields)
+	if err != nil {
+		return err
+	}
+	return s.readMultiple(sl, projected)
+}
+
+// ReadKeys populates the slice dst with the items of keys, in the order of
+// keys. It returns a store.MultiError with the keys that are not found,
+// unless store.SkipMissing is passed. With the store.Fields option, only the
+// fields named are read.
+func (s *Store) ReadKeys(keys []string, dst interface{}, opts ...store.ReadOption) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	o := store.NewReadOptions(opts)
+	fields, err := lookupFields(sl.Type(), o.Fields)
+	if err != nil {
+		return err
+	}
+	if err := sl.SetKeys(keys); err != nil {
+		return err
+	}
+	err = s.readMultiple(sl, fields)
+	if o.SkipMissing {
+		return sl.RemoveNotFound(err)
+	}
+	return err
+}
+
+// readMultiple is a helper function that reads the fields of the items in
+// the slice sl, or all of their fields when fields is empty
+func (s *Store) readMultiple(sl *store.Slice, fields []store.Field) error {
+	now := time.Now()
+	s.data.mu.RLock()
+	defer s.data.mu.RUnlock()
+	coll := s.data.collections[s.typeName(sl.Type())]
+	var errs store.MultiError
+	for y := 0; y < sl.Len(); y++ {
+		key := sl.Item(y).Key()
+		// projected items are read in place to leave their other fields
+		// untouched
+		if len(fields) > 0 {
+			if err := s.readRecord(coll[key], key, sl.Item(y), now, fields); err != nil {
+				errs = append(errs, store.ItemError{Index: y, Key: key, Err: err})
+			}
+			continue
+		}
+		// items that fail are reset to their zero value
+		it := sl.New()
+		if err := s.readRecord(coll[key], key, it, now, nil); err != nil {
+			errs = append(errs, store.ItemError{Index: y, Key: key, Err: err})
+			it = sl.New()
+		}
+		sl.Set(y, it)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// readRecord is a helper function that copies the fields of the record of
+// the key to the item it
+func (s *Store) readRecord(rec *record, key string, it store.Item, now time.Time, fields []store.Field) error {
+	if err := store.ValidateKey(key); err != nil {
+		return err
+	}
+	if !rec.live(now) {
+		return store.ErrKeyNotFound
+	}
+	if err := rec.copyTo(it, now, fields); err != nil {
+		return err
+	}
+	// the key may not be part of the fields of items that implement
+	// store.Marshaler
+	it.SetKey(key)
+	return nil
+}
+
+// lookupFields is a helper function that returns the fields of the item type
+// t by their Go name or the name they are stored under
+func lookupFields(t reflect.Type, names []string) ([]store.Field, error) {
+	var fields []store.Field
+	for _, name := range names {
+		f, err := store.LookupField(t, name)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// Write writes the item to the store, replacing the values stored for its
+// key. When the key is empty, it assigns a unique universal id(UUID) using the
+// SetKey method of the Item.
+func (s *Store) Write(i store.Item) error {
+	return single(s.WriteMultiple([]store.Item{i}))
+}
+
+// WriteMultiple writes multiple items i to the store atomically. Like Write,
+// it assigns a UUID to items with empty keys. No items are written when any
+// of the items fail to convert. Items that implement store.Expirer expire
+// after their TTL. No items are written when the version of any item that
+// implements store.Versioner doesn't match the stored version. It returns a
+// store.MultiError with the items that fail, with store.ErrConflict for the
+// items with mismatched versions.
+func (s *Store) WriteMultiple(items []store.Item) error {
+	var errs store.MultiError
+	for n, i := range items {
+		if err := store.ValidateCollection(reflect.TypeOf(i)); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: err})
+		} else if len(i.Key()) == 0 {
+			i.SetKey(uuid.New().String())
+		} else if err := store.ValidateKey(i.Key()); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	fields, err := marshal(items)
+	if err != nil {
+		return err
+	}
+	return s.write(items, fields, false)
+}
+
+// Patch writes the fields of the item over the values stored for its key,
+// leaving stored fields that are not part of the item in place. When the key
+// is empty, it returns a store.ErrEmptyKey error. When the key does not exist,
+// it returns a store.ErrKeyNotFound error.
+func (s *Store) Patch(i store.Item) error {
+	if err := validate(i); err != nil {
+		return err
+	}
+	fields, err := marshal([]store.Item{i})
+	if err != nil {
+		return single(err)
+	}
+	return single(s.write([]store.Item{i}, fields, true))
+}
+
+// marshal is a helper function that returns the fields of the items, or a
+// store.MultiError with the items that fail to convert
+func marshal(items []store.Item) ([]map[string][]byte, error) {
+	var errs store.MultiError
+	fields := make([]map[string][]byte, len(items))
+	for n, i := range items {
+		f, err := store.Marshal(i)
+		if err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: err})
+			continue
+		}
+		fields[n] = f
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return fields, nil
+}
+
+// single is a helper function that returns the error of the item of a
+// store.MultiError returned for a single item
+func single(err error) error {
+	if merr, ok := err.(store.MultiError); ok && len(merr) == 1 {
+		return merr[0].Err
+	}
+	return err
+}
+
+// write is a helper function that writes the fields of the items
+// atomically, replacing the stored records or merging the fields into them.
+// It returns a store.MultiError with the items that fail.
+func (s *Store) write(items []store.Item, fields []map[string][]byte, merge bool) error {
+	now := time.Now()
+	recs := make([]*record, len(items))
+	for n, i := range items {
+		recs[n] = &record{fields: fields[n], created: now}
+		if e, ok := i.(store.Expirer); ok && e.TTL() > 0 {
+			recs[n].expires = now.Add(e.TTL())
+		}
+	}
+
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+	var errs store.MultiError
+	for n, i := range items {
+		rec := s.data.collections[s.typeName(reflect.TypeOf(i).Elem())][i.Key()]
+		if !rec.live(now) {
+			rec = nil
+		} else {
+			recs[n].created = rec.created
+		}
+		if merge {
+			if rec == nil {
+				errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: store.ErrKeyNotFound})
+				continue
+			}
+			for k, b := range rec.fields {
+				if _, ok := recs[n].fields[k]; !ok {
+					recs[n].fields[k] = b
+				}
+			}
+			// the expiry is kept unless the item sets its own
+			if _, ok := i.(store.Expirer); !ok {
+				recs[n].expires = rec.expires
+			}
+		}
+		v, ok := i.(store.Versioner)
+		if !ok {
+			continue
+		}
+		var current int64
+		if rec != nil {
+			current = rec.version
+		}
+		if v.Version() != current {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: store.ErrConflict})
+			continue
+		}
+		recs[n].version = current + 1
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	for n, i := range items {
+		name := s.typeName(reflect.TypeOf(i).Elem())
+		coll, ok := s.data.collections[name]
+		if !ok {
+			coll = make(map[string]*record)
+			s.data.collections[name] = coll
+		}
+		coll[i.Key()] = recs[n]
+		if v, ok := i.(store.Versioner); ok {
+			v.SetVersion(recs[n].version)
+		}
+	}
+	return nil
+}
+
+// Delete deletes the item from the store. When the key is empty, it returns a
+// store.ErrEmptyKey error. When the key does not exist, it returns a
+// store.ErrKeyNotFound error.
+func (s *Store) Delete(i store.Item) error {
+	if err := validate(i); err != nil {
+		return err
+	}
+	if count, _ := s.DeleteMultiple([]store.Item{i}); count == 0 {
+		return store.ErrKeyNotFound
+	}
+	return nil
+}
+
+// DeleteMultiple deletes multiple items i from the store. It returns the count
+// of items successfully deleted. It returns a store.MultiError with the items
+// that do not exist or have invalid keys, it will delete the other items in
+// that case.
+func (s *Store) DeleteMultiple(items []store.Item) (int, error) {
+	now := time.Now()
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+	var count int
+	var errs store.MultiError
+	for n, i := range items {
+		if err := validate(i); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: err})
+			continue
+		}
+		coll := s.data.collections[s.typeName(reflect.TypeOf(i).Elem())]
+		rec, ok := coll[i.Key()]
+		if ok {
+			delete(coll, i.Key())
+		}
+		if !rec.live(now) {
+			errs = append(errs, store.ItemError{Index: n, Key: i.Key(), Err: store.ErrKeyNotFound})
+			continue
+		}
+		count++
+	}
+	if len(errs) > 0 {
+		return count, errs
+	}
+	return count, nil
+}
+
+// List populates the slice with ids of the slice element type. The ids are
+// sorted in lexical order.
+func (s *Store) List(i interface{}) error {
+	sl, err := store.NewSlice(i)
+	if err != nil {
+		return err
+	}
+	return sl.SetKeys(s.keys(sl.Type()))
+}
+
+// ListPage populates the slice dst with up to limit ids of the slice element
+// type, in lexical order, following the id cursor. The cursor returned is the
+// last id of the page, or empty after the last page. All the remaining ids
+// are returned when limit is zero or less.
+func (s *Store) ListPage(dst interface{}, cursor string, limit int) (string, error) {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return "", err
+	}
+	keys := s.keys(sl.Type())
+	keys = keys[sort.SearchStrings(keys, cursor):]
+	if len(keys) > 0 && keys[0] == cursor {
+		keys = keys[1:]
+	}
+	var next string
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	return next, sl.SetKeys(keys)
+}
+
+// keys is a helper function that returns the sorted ids of the live records
+// of the collection of the item type t
+func (s *Store) keys(t reflect.Type) []string {
+	now := time.Now()
+	name := s.typeName(t)
+	s.data.mu.RLock()
+	coll := s.data.collections[name]
+	keys := make([]string, 0, len(coll))
+	var expired []string
+	for key, rec := range coll {
+		if rec.live(now) {
+			keys = append(keys, key)
+		} else {
+			expired = append(expired, key)
+		}
+	}
+	s.data.mu.RUnlock()
+	s.purge(name, expired...)
+	sort.Strings(keys)
+	return keys
+}
+
+// purge is a helper function that removes the records with the keys from
+// the collection, when they have expired
+func (s *Store) purge(name string, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	now := time.Now()
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+	coll := s.data.collections[name]
+	for _, key := range keys {
+		if rec, ok := coll[key]; ok && !rec.live(now) {
+			delete(coll, key)
+		}
+	}
+}
+
+// validate is a helper function that returns the error of the key of the
+// item, see store.ValidateKey, or store.ErrEmptyCollection when the type of
+// the item has no collection name
+func validate(i store.Item) error {
+	if err := store.ValidateCollection(reflect.TypeOf(i)); err != nil {
+		return err
+	}
+	return store.ValidateKey(i.Key())
+}
+
+// typeName is a helper function to return the collection name of the item
+// type t in the namespace of the store.
+func (s *Store) typeName(t reflect.Type) string {
+	name := store.CollectionName(t)
+	if len(s.namespace) != 0 {
+		return s.namespace + ":" + name
+	}
+	return name
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gosuri/go-store/store"
+	"github.com/gosuri/go-store/storetest"
+)
+
+type TestM struct {
+	ID         string
+	Field      string
+	FieldFloat float32
+	FieldInt   int
+	FieldBool  bool
+	FieldUint  uint
+
+	fieldPrivate string
+}
+
+func (s *TestM) Key() string {
+	return s.ID
+}
+
+func (s *TestM) SetKey(k string) {
+	s.ID = k
+}
+
+type OtherM struct {
+	ID string
+}
+
+func (s *OtherM) Key() string {
+	return s.ID
+}
+
+func (s *OtherM) SetKey(k string) {
+	s.ID = k
+}
+
+func TestConformance(t *testing.T) {
+	root := New("")
+	storetest.RunConformance(t, func() store.Store {
+		return root.WithNamespace(uuid.New().String())
+	})
+}
+
+func TestWriteRead(t *testing.T) {
+	db := New("test")
+	s := &TestM{
+		Field:        "value",
+		FieldInt:     10,
+		FieldFloat:   1.234,
+		FieldBool:    true,
+		FieldUint:    1,
+		fieldPrivate: "private",
+	}
+	if err := db.Write(s); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(s.Key()) == 0 {
+		t.Fatalf("key is emtpy %#v", s)
+	}
+
+	got := &TestM{ID: s.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	s.fieldPrivate = ""
+	if !reflect.DeepEqual(s, got) {
+		t.Fatal("expected:", s, " got:", got)
+	}
+}
+
+func TestReadNotFound(t *testing.T) {
+	db := New("test")
+	if err := db.Read(&TestM{ID: "invalid"}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := db.Read(&TestM{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	db := New("test")
+	s := &TestM{Field: "value"}
+	if err := db.Write(s); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Read(&OtherM{ID: s.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound from other type, got: ", err)
+	}
+	if err := db.WithNamespace("other").Read(&TestM{ID: s.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound from other namespace, got: ", err)
+	}
+	if err := db.WithNamespace("test").Read(&TestM{ID: s.Key()}); err != nil {
+		t.Fatal("err", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db := New("test")
+	s := &TestM{Field: "value"}
+	if err := db.Write(s); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Delete(&TestM{ID: s.Key()}); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Delete(&TestM{ID: s.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := db.Delete(&TestM{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+}
+
+func TestPartialDeleteMultiple(t *testing.T) {
+	db := New("test")
+	s, s1 := &TestM{Field: "value"}, &TestM{Field: "value1"}
+	if err := db.WriteMultiple([]store.Item{s, s1}); err != nil {
+		t.Fatal("err", err)
+	}
+	count, err := db.DeleteMultiple([]store.Item{s, s1, &TestM{ID: "invalid"}})
+	if merr, ok := err.(store.MultiError); !ok || merr.Err(2) != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound for the third item, got: ", err)
+	}
+	if count != 2 {
+		t.Fatal("expected 2 deletions, got: ", count)
+	}
+}
+
+func TestListReadMultiple(t *testing.T) {
+	db := New("test")
+	items := []TestM{{Field: "a", FieldInt: 1}, {Field: "b", FieldInt: 2}}
+	if err := db.WriteMultiple([]store.Item{&items[0], &items[1]}); err != nil {
+		t.Fatal("err", err)
+	}
+	if items[0].ID > items[1].ID {
+		items[0], items[1] = items[1], items[0]
+	}
+
+	var got []TestM
+	if err := db.List(&got); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(got) != len(items) {
+		t.Fatalf("expected length to be %d, got: %d", len(items), len(got))
+	}
+	if err := db.ReadMultiple(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", items, got)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	db := New("test")
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s := &TestM{Field: "..."}
+				db.Write(s)
+				db.Read(&TestM{ID: s.Key()})
+				var items []TestM
+				db.List(&items)
+				db.Delete(s)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var items []TestM
+	if err := db.List(&items); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(items) != 0 {
+		t.Fatal("expected no items, got: ", len(items))
+	}
+}
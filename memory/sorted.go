@@ -0,0 +1,64 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/gosuri/go-store/store"
+)
+
+// ListSorted populates the slice dst with ids of the slice element type in
+// the order described by by. Items are ordered by the time they were first
+// written when by.Field is empty.
+func (s *Store) ListSorted(dst interface{}, by store.Sort) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	var x store.Index
+	if by.Field != "" {
+		if x, err = store.LookupIndex(sl.Type(), by.Field); err != nil {
+			return err
+		}
+		if !x.Numeric {
+			return store.ErrNotIndexed
+		}
+	}
+
+	scores := make(map[string]float64)
+	keys := s.find(s.typeName(sl.Type()), func(key string, rec *record) bool {
+		if by.Field == "" {
+			scores[key] = float64(rec.created.UnixNano())
+			return true
+		}
+		score, err := x.Score(rec.fields[x.Field])
+		if err != nil {
+			return false
+		}
+		scores[key] = score
+		return true
+	})
+	// the keys are sorted, ties keep the order of their keys
+	sort.SliceStable(keys, func(a, b int) bool {
+		return scores[keys[a]] < scores[keys[b]]
+	})
+	if by.Descending {
+		for a, b := 0, len(keys)-1; a < b; a, b = a+1, b-1 {
+			keys[a], keys[b] = keys[b], keys[a]
+		}
+	}
+
+	if by.Offset > 0 {
+		if by.Offset > len(keys) {
+			by.Offset = len(keys)
+		}
+		keys = keys[by.Offset:]
+	}
+	if by.Limit > 0 && by.Limit < len(keys) {
+		keys = keys[:by.Limit]
+	}
+	return sl.SetKeys(keys)
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gosuri/go-store/store"
+)
+
+// UpdateFields writes the values of fields to the record stored for the item,
+// leaving the other fields in place. Like Patch, it returns a
+// store.ErrKeyNotFound error when the key does not exist.
+func (s *Store) UpdateFields(i store.Item, fields map[string]interface{}) error {
+	if err := validate(i); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(i)
+	data := make(map[string][]byte, len(fields))
+	for name, value := range fields {
+		f, err := store.LookupField(t, name)
+		if err != nil {
+			return err
+		}
+		if data[f.Name], err = f.Encode(value); err != nil {
+			return err
+		}
+	}
+	return single(s.write([]store.Item{i}, []map[string][]byte{data}, true))
+}
+
+// Increment atomically adds delta to the integer field of the item and
+// returns the new value. It returns an error, leaving the field unchanged,
+// when the new value overflows the type of the field.
+func (s *Store) Increment(i store.Item, field string, delta int64) (int64, error) {
+	var n int64
+	err := s.increment(i, field, func(f store.Field, cur string) ([]byte, error) {
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v, err := strconv.ParseInt(cur, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			sum := v + delta
+			if (sum > v) != (delta > 0) || f.OverflowInt(sum) {
+				return nil, fmt.Errorf("store: incrementing %s by %d overflows %s", f.Name, delta, f.Kind())
+			}
+			n = sum
+			return strconv.AppendInt(nil, n, 10), nil
+		}
+		return nil, fmt.Errorf("store: cannot increment %s (type: %s)", f.Name, f.Kind())
+	})
+	return n, err
+}
+
+// IncrementFloat atomically adds delta to the float field of the item and
+// returns the new value. Like Increment, it returns an error when the new
+// value overflows the type of the field.
+func (s *Store) IncrementFloat(i store.Item, field string, delta float64) (float64, error) {
+	var n float64
+	err := s.increment(i, field, func(f store.Field, cur string) ([]byte, error) {
+		if k := f.Kind(); k != reflect.Float32 && k != reflect.Float64 {
+			return nil, fmt.Errorf("store: cannot increment %s (type: %s)", f.Name, k)
+		}
+		v, err := strconv.ParseFloat(cur, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum := v + delta
+		if f.OverflowFloat(sum) {
+			return nil, fmt.Errorf("store: incrementing %s by %g overflows %s", f.Name, delta, f.Kind())
+		}
+		n = sum
+		return strconv.AppendFloat(nil, n, 'g', -1, 64), nil
+	})
+	return n, err
+}
+
+// increment is a helper function that replaces the stored value of the field
+// with the value returned by add, and increments the version of the record.
+// Fields without a stored value are added to as zero.
+func (s *Store) increment(i store.Item, field string, add func(f store.Field, cur string) ([]byte, error)) error {
+	if err := validate(i); err != nil {
+		return err
+	}
+	f, err := store.LookupField(reflect.TypeOf(i), field)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := s.typeName(reflect.TypeOf(i).Elem())
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+	rec := s.data.collections[name][i.Key()]
+	if !rec.live(now) {
+		return store.ErrKeyNotFound
+	}
+	cur := string(rec.fields[f.Name])
+	if len(cur) == 0 {
+		cur = "0"
+	}
+	b, err := add(f, cur)
+	if err != nil {
+		return err
+	}
+	// records are replaced rather than modified, readers may hold on to
+	// the fields of the current record
+	fields := make(map[string][]byte, len(rec.fields))
+	for k, v := range rec.fields {
+		fields[k] = v
+	}
+	fields[f.Name] = b
+	s.data.collections[name][i.Key()] = &record{
+		fields:  fields,
+		expires: rec.expires,
+		version: rec.version + 1,
+		created: rec.created,
+	}
+	if v, ok := i.(store.Versioner); ok {
+		v.SetVersion(rec.version + 1)
+	}
+	return nil
+}
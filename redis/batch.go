@@ -0,0 +1,406 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// maxAttempts is the number of times a transaction is attempted when
+// another client modifies the keys it watches
+const maxAttempts = 8
+
+// errAborted means that a transaction was not executed because another
+// client modified a watched key
+var errAborted = errors.New("store: transaction aborted, watched keys were modified")
+
+// versionField is the hash field that stores the version of items that
+// implement store.Versioner
+const versionField = "_version"
+
+// emptyField is the hash field that stores items with no stored fields, as
+// redis removes empty hashes
+const emptyField = "_empty"
+
+// writeBatch is a helper function that writes the items in a single
+// MULTI/EXEC block, together with the entries of their indexed fields. The
+// stored hash of each item is replaced, unless the item is merged into it.
+// Batches with versioned items are not retried when aborted, they return
+// store.ErrConflict instead.
+func (s *Redis) writeBatch(c driver.Conn, ritems []*item) error {
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err = s.execWrite(c, ritems); err != errAborted {
+			return err
+		}
+		for _, ri := range ritems {
+			if ri.versioner != nil {
+				return store.ErrConflict
+			}
+		}
+	}
+	return err
+}
+
+// execWrite is a helper function that makes a single attempt at writing the
+// items for writeBatch
+func (s *Redis) execWrite(c driver.Conn, ritems []*item) error {
+	if err := s.watch(c, ritems); err != nil {
+		return err
+	}
+	// Compare-and-swap the versions, the watch aborts the transaction when
+	// another client writes the item after its version was read
+	for _, ri := range ritems {
+		if ri.merge && !ri.exists {
+			return store.ErrKeyNotFound
+		}
+		if ri.versioner != nil && ri.versioner.Version() != ri.version {
+			return store.ErrConflict
+		}
+	}
+	// Mark the start of a transaction block, the commands are queued in
+	// the output buffer and sent together with EXEC
+	if err := c.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, ri := range ritems {
+		if ri.codec != nil {
+			// documents are replaced as a whole, along with their
+			// expiry
+			if err := sendDocument(c, ri); err != nil {
+				return err
+			}
+		} else if err := sendHash(c, ri); err != nil {
+			return err
+		}
+		if err := sendExpire(c, ri); err != nil {
+			return err
+		}
+		if err := s.sendIndexes(c, ri); err != nil {
+			return err
+		}
+		if err := s.sendMember(c, ri, false); err != nil {
+			return err
+		}
+	}
+	if _, err := exec(c); err != nil {
+		return err
+	}
+	for _, ri := range ritems {
+		if ri.versioner != nil {
+			ri.versioner.SetVersion(ri.version + 1)
+		}
+	}
+	return nil
+}
+
+// sendHash is a helper function that queues the commands writing the data
+// of the item to its hash
+func sendHash(c driver.Conn, ri *item) error {
+	// Deleting the hash first removes the fields that are no longer
+	// part of the item, and any expiry the item no longer has
+	if !ri.merge {
+		if err := c.Send("DEL", ri.Key()); err != nil {
+			return err
+		}
+	}
+	args := driver.Args{}.Add(ri.Key())
+	for key, val := range ri.data {
+		args = args.Add(key, val)
+	}
+	if ri.versioner != nil {
+		args = args.Add(versionField, ri.version+1)
+	}
+	if len(args) == 1 && !ri.merge {
+		args = args.Add(emptyField, "")
+	}
+	// HMSET expects at least one field
+	if len(args) > 1 {
+		return c.Send("HMSET", args...)
+	}
+	return nil
+}
+
+// sendDocument is a helper function that queues the commands writing the
+// document of the item, and the version of versioned items
+func sendDocument(c driver.Conn, ri *item) error {
+	if err := c.Send("SET", ri.Key(), ri.doc); err != nil {
+		return err
+	}
+	if ri.versioner != nil {
+		return c.Send("SET", ri.versionKey(), ri.version+1)
+	}
+	return nil
+}
+
+// sendExpire is a helper function that queues the commands setting the
+// expiry of items that implement store.Expirer, and of the versions of
+// documents. The expiry is removed when the TTL is zero or less.
+func sendExpire(c driver.Conn, ri *item) error {
+	if !ri.expirer {
+		return nil
+	}
+	keys := []string{ri.Key()}
+	if ri.codec != nil && ri.versioner != nil {
+		keys = append(keys, ri.versionKey())
+	}
+	for _, key := range keys {
+		var err error
+		if ri.ttl <= 0 {
+			err = c.Send("PERSIST", key)
+		} else {
+			// round up, PEXPIRE deletes the key right away when zero
+			ms := (ri.ttl + time.Millisecond - 1) / time.Millisecond
+			err = c.Send("PEXPIRE", key, int64(ms))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBatch is a helper function that deletes the items in a single
+// MULTI/EXEC block, together with the entries of their indexed fields. It
+// returns the number of items deleted.
+func (s *Redis) deleteBatch(c driver.Conn, ritems []*item) (int, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		count, err := s.execDelete(c, ritems)
+		if err != errAborted {
+			return count, err
+		}
+	}
+	return 0, errAborted
+}
+
+// execDelete is a helper function that makes a single attempt at deleting
+// the items for deleteBatch
+func (s *Redis) execDelete(c driver.Conn, ritems []*item) (int, error) {
+	if err := s.watch(c, ritems); err != nil {
+		return 0, err
+	}
+	if err := c.Send("MULTI"); err != nil {
+		return 0, err
+	}
+	// Queue the DEL commands first so their replies lead the EXEC reply
+	for _, ri := range ritems {
+		if err := c.Send("DEL", ri.Key()); err != nil {
+			return 0, err
+		}
+	}
+	for _, ri := range ritems {
+		if ri.codec != nil && ri.versioner != nil {
+			if err := c.Send("DEL", ri.versionKey()); err != nil {
+				return 0, err
+			}
+		}
+		ri.data = nil
+		if err := s.sendIndexes(c, ri); err != nil {
+			return 0, err
+		}
+		if err := s.sendMember(c, ri, true); err != nil {
+			return 0, err
+		}
+	}
+	reply, err := exec(c)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for n, r := range reply[:len(ritems)] {
+		deleted, _ := driver.Int(r, nil)
+		ritems[n].exists = deleted > 0
+		count += deleted
+	}
+	return count, nil
+}
+
+// watch is a helper function that watches the keys of the items with
+// indexed fields or versions and reads the stored values of those fields,
+// so their index entries can be replaced and versions compared in the
+// transaction that follows. Items being merged are watched as well, to
+// check they exist.
+func (s *Redis) watch(c driver.Conn, ritems []*item) error {
+	var keys []interface{}
+	var indexed []*item
+	for _, ri := range ritems {
+		if len(ri.indexes) > 0 || ri.versioner != nil || ri.merge {
+			keys = append(keys, ri.Key())
+			indexed = append(indexed, ri)
+		}
+	}
+	if len(indexed) == 0 {
+		return nil
+	}
+
+	if err := c.Send("WATCH", keys...); err != nil {
+		return err
+	}
+	for _, ri := range indexed {
+		// the indexed fields of documents are read from the stored
+		// document, their versions from the version key
+		if ri.codec != nil {
+			if err := c.Send("GET", ri.Key()); err != nil {
+				return err
+			}
+			if ri.versioner != nil {
+				if err := c.Send("GET", ri.versionKey()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if ri.merge {
+			if err := c.Send("EXISTS", ri.Key()); err != nil {
+				return err
+			}
+		}
+		args := driver.Args{}.Add(ri.Key())
+		for _, x := range ri.indexes {
+			args = args.Add(x.Field)
+		}
+		args = args.Add(versionField)
+		if err := c.Send("HMGET", args...); err != nil {
+			return err
+		}
+	}
+	// Do with an empty command flushes the pipeline and returns the
+	// replies of all the commands sent
+	reply, err := driver.Values(c.Do(""))
+	if err != nil {
+		return err
+	}
+	// skip the reply of WATCH
+	reply = reply[1:]
+	for _, ri := range indexed {
+		if ri.codec != nil {
+			if reply, err = s.watchDocument(ri, reply); err != nil {
+				return err
+			}
+			continue
+		}
+		if ri.merge {
+			if ri.exists, err = driver.Bool(reply[0], nil); err != nil {
+				return err
+			}
+			reply = reply[1:]
+		}
+		values, err := driver.ByteSlices(reply[0], nil)
+		if err != nil {
+			return err
+		}
+		reply = reply[1:]
+		ri.old = make(map[string][]byte)
+		for y, x := range ri.indexes {
+			if values[y] != nil {
+				ri.old[x.Field] = values[y]
+			}
+		}
+		// the version of items that were never written is zero
+		ri.version = 0
+		if b := values[len(ri.indexes)]; b != nil {
+			if ri.version, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// watchDocument is a helper function that reads the stored document of the
+// item and its version from the replies of watch. It returns the replies
+// that follow.
+func (s *Redis) watchDocument(ri *item, reply []interface{}) ([]interface{}, error) {
+	doc, err := driver.Bytes(reply[0], nil)
+	if err != nil && err != driver.ErrNil {
+		return nil, err
+	}
+	reply = reply[1:]
+	ri.exists = doc != nil
+	if ri.old, err = s.documentFields(ri, doc); err != nil {
+		return nil, err
+	}
+	// the version of items that were never written is zero
+	ri.version = 0
+	if ri.versioner != nil {
+		ri.version, err = driver.Int64(reply[0], nil)
+		if err != nil && err != driver.ErrNil {
+			return nil, err
+		}
+		reply = reply[1:]
+	}
+	return reply, nil
+}
+
+// sendIndexes is a helper function that queues the commands replacing the
+// index entries of the stored values of the item with entries of its data.
+// The entries are removed when the item has no data.
+func (s *Redis) sendIndexes(c driver.Conn, ri *item) error {
+	for _, x := range ri.indexes {
+		old, hasOld := ri.old[x.Field]
+		val, hasNew := ri.data[x.Field]
+		// merged items only replace the entries of the fields they have
+		if ri.merge && !hasNew {
+			continue
+		}
+		if x.Numeric {
+			// a sorted set scored by value, adding a member
+			// updates its score
+			key := s.indexKey(ri.typ, x, nil)
+			if hasNew {
+				score, err := x.Score(val)
+				if err != nil {
+					return err
+				}
+				if err := c.Send("ZADD", key, score, ri.key); err != nil {
+					return err
+				}
+			} else if hasOld {
+				if err := c.Send("ZREM", key, ri.key); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// a set for each value
+		if hasOld && (!hasNew || !bytes.Equal(old, val)) {
+			if err := c.Send("SREM", s.indexKey(ri.typ, x, old), ri.key); err != nil {
+				return err
+			}
+		}
+		if hasNew {
+			if err := c.Send("SADD", s.indexKey(ri.typ, x, val), ri.key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exec is a helper function that executes the queued transaction. It
+// returns errAborted when a watched key was modified.
+func exec(c driver.Conn) ([]interface{}, error) {
+	reply, err := driver.Values(c.Do("EXEC"))
+	if err == driver.ErrNil {
+		return nil, errAborted
+	}
+	if err != nil {
+		return nil, err
+	}
+	// EXEC replies with the result of each queued command, any of
+	// which may have failed independently
+	for _, r := range reply {
+		if err, ok := r.(driver.Error); ok {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// Count returns the number of items of the type of sample, an item or a
+// slice of items, that have not expired. Stores with Config.Members set
+// count the ids of the sorted set of ids with ZSCAN, removing the ids of
+// expired items. Other stores count the distinct keys of a SCAN of the
+// keyspace, which may return a key more than once.
+func (s *Redis) Count(sample interface{}) (int, error) {
+	return s.CountContext(context.Background(), sample)
+}
+
+// CountContext is like Count but stops scanning the keyspace when ctx is
+// done.
+func (s *Redis) CountContext(ctx context.Context, sample interface{}) (int, error) {
+	t, err := store.ItemType(sample)
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	seen := make(map[string]bool)
+	var cursor int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		next, keys, err := s.listPage(c, t, cursor, MaxItems)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return len(seen), nil
+}
+
+// Exists reports whether the item is stored using EXISTS. When the key is
+// empty, it returns a store.ErrEmptyKey error.
+func (s *Redis) Exists(i store.Item) (bool, error) {
+	return s.ExistsContext(context.Background(), i)
+}
+
+// ExistsContext is like Exists but gives up acquiring a connection when ctx
+// is done.
+func (s *Redis) ExistsContext(ctx context.Context, i store.Item) (bool, error) {
+	exists, err := s.ExistsMultipleContext(ctx, []store.Item{i})
+	if err != nil {
+		return false, err
+	}
+	return exists[0], nil
+}
+
+// ExistsMultiple reports whether each of the items is stored, sending the
+// EXISTS commands in a single pipeline. Like Exists, it expects the keys of
+// the items to be set.
+func (s *Redis) ExistsMultiple(items []store.Item) ([]bool, error) {
+	return s.ExistsMultipleContext(context.Background(), items)
+}
+
+// ExistsMultipleContext is like ExistsMultiple but gives up acquiring a
+// connection when ctx is done.
+func (s *Redis) ExistsMultipleContext(ctx context.Context, items []store.Item) ([]bool, error) {
+	ritems := make([]*item, len(items))
+	for n, i := range items {
+		ritems[n] = s.newItem(i)
+		if err := ritems[n].validate(); err != nil {
+			return nil, err
+		}
+	}
+	exists := make([]bool, len(items))
+	if len(items) == 0 {
+		return exists, nil
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	for _, ri := range ritems {
+		if err := c.Send("EXISTS", ri.Key()); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := driver.Values(c.Do(""))
+	if err != nil {
+		return nil, err
+	}
+	for n := range exists {
+		if exists[n], err = driver.Bool(reply[n], nil); err != nil {
+			return nil, err
+		}
+	}
+	return exists, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// ErrDocument means that the operation is not supported for items stored as
+// documents
+var ErrDocument = errors.New("store: not supported for items stored as documents")
+
+// errNotDocument means that the items to migrate are not stored as documents
+var errNotDocument = errors.New("store: item type is not stored as documents")
+
+// documentCodec is a helper function that returns the codec of items of the
+// struct type t when they are stored as documents, or nil when they are
+// stored as hashes
+func (s *Redis) documentCodec(t reflect.Type) store.Codec {
+	if c, ok := s.documentTypes[store.CollectionName(t)]; ok {
+		return c
+	}
+	return s.document
+}
+
+// encode is a helper function that converts i to the data of the redis item,
+// or to its document for items stored as documents, see
+// store.MarshalDocument. The data of documents only holds the values of the
+// indexed fields.
+func (s *Redis) encode(ri *item, i store.Item) (err error) {
+	if ri.codec == nil {
+		ri.data, err = s.encoding().Marshal(i)
+		return err
+	}
+	if ri.doc, err = store.MarshalDocument(ri.codec, i); err != nil {
+		return err
+	}
+	ri.data, err = s.encoding().MarshalIndexes(i)
+	return err
+}
+
+// documentFields is a helper function that returns the values of the
+// indexed fields of the document doc of the item
+func (s *Redis) documentFields(ri *item, doc []byte) (map[string][]byte, error) {
+	if doc == nil || len(ri.indexes) == 0 {
+		return make(map[string][]byte), nil
+	}
+	i := reflect.New(ri.typ).Interface().(store.Item)
+	if err := store.UnmarshalDocument(ri.codec, doc, i, nil); err != nil {
+		return nil, err
+	}
+	return s.encoding().MarshalIndexes(i)
+}
+
+// MigrateDocuments converts the items of the type of i that are stored as
+// hashes to documents, encoded with the codec configured for the type by
+// Config.Document or Config.DocumentTypes. The hashes are decoded into items
+// of the type, which are then encoded as documents. Their versions, remaining time to
+// live and index entries are kept. Items already stored as documents are
+// skipped, so it is safe to run again when it stops early. It returns the
+// number of items converted.
+func (s *Redis) MigrateDocuments(i store.Item) (int, error) {
+	tmpl := s.newItem(i)
+	if tmpl.codec == nil {
+		return 0, errNotDocument
+	}
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	prefix := tmpl.prefix + s.sep
+	keys, err := s.scan(context.Background(), c, matchPrefix(prefix))
+	if err != nil {
+		return 0, err
+	}
+	keys = s.trimKeys(keys, prefix)
+	var count int
+	for _, key := range keys {
+		ri := *tmpl
+		ri.key = key
+		migrated, err := s.migrate(c, &ri)
+		if err != nil {
+			return count, err
+		}
+		if migrated {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// migrate is a helper function that converts the hash of the item to a
+// document. It reports false when the item is not stored as a hash.
+func (s *Redis) migrate(c driver.Conn, ri *item) (bool, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if _, err := c.Do("WATCH", ri.Key()); err != nil {
+			return false, err
+		}
+		typ, err := driver.String(c.Do("TYPE", ri.Key()))
+		if err != nil {
+			return false, err
+		}
+		if typ != "hash" {
+			_, err := c.Do("UNWATCH")
+			return false, err
+		}
+		reply, err := c.Do("HGETALL", ri.Key())
+		if err != nil {
+			return false, err
+		}
+		data, err := hash(reply)
+		if err != nil {
+			return false, err
+		}
+		pttl, err := driver.Int64(c.Do("PTTL", ri.Key()))
+		if err != nil {
+			return false, err
+		}
+		version, err := versionOf(data)
+		if err != nil {
+			return false, err
+		}
+		// the hash is decoded into the item, the version moves to the
+		// version key
+		i := reflect.New(ri.typ).Interface().(store.Item)
+		if err := s.encoding().Unmarshal(data, i); err != nil {
+			return false, err
+		}
+		i.SetKey(ri.key)
+		doc, err := store.MarshalDocument(ri.codec, i)
+		if err != nil {
+			return false, err
+		}
+
+		c.Send("MULTI")
+		c.Send("DEL", ri.Key())
+		c.Send("SET", ri.Key(), doc)
+		if ri.versioner != nil && version > 0 {
+			c.Send("SET", ri.versionKey(), version)
+		}
+		if pttl > 0 {
+			c.Send("PEXPIRE", ri.Key(), pttl)
+			if ri.versioner != nil && version > 0 {
+				c.Send("PEXPIRE", ri.versionKey(), pttl)
+			}
+		}
+		_, err = exec(c)
+		if err != errAborted {
+			return err == nil, err
+		}
+	}
+	return false, errAborted
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"reflect"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// lookupFields is a helper function that returns the fields of the item
+// type t by their Go name or the name they are stored under
+func (s *Redis) lookupFields(t reflect.Type, names []string) ([]store.Field, error) {
+	var fields []store.Field
+	for _, name := range names {
+		f, err := s.encoding().LookupField(t, name)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// hmget reports whether the fields read of the item are read with HMGET.
+// The names of the values of flattened fields are not known before they
+// are read, such items are read with HGETALL.
+func (i *item) hmget() bool {
+	if i.codec != nil || len(i.fields) == 0 {
+		return false
+	}
+	for _, f := range i.fields {
+		if f.Flattened() {
+			return false
+		}
+	}
+	return true
+}
+
+// readHash is a helper function that returns the hash fields in the replies
+// of the commands queued by sendRead, and reports whether the hash exists
+func (s *Redis) readHash(ri *item, replies []interface{}) (map[string][]byte, bool, error) {
+	if !ri.hmget() {
+		data, err := hash(replies[0])
+		found := len(data) > 0
+		delete(data, emptyField)
+		return data, found, err
+	}
+	exists, err := driver.Bool(replies[len(replies)-1], nil)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	values, err := driver.ByteSlices(replies[0], nil)
+	if err != nil {
+		return nil, false, err
+	}
+	names := make([]string, 0, len(values))
+	for _, f := range ri.fields {
+		names = append(names, f.Name)
+	}
+	if ri.versioner != nil {
+		names = append(names, versionField)
+	}
+	data := make(map[string][]byte, len(values))
+	for n, b := range values {
+		// fields that are not stored, such as nil pointers
+		if b != nil {
+			data[names[n]] = b
+		}
+	}
+	return data, true, nil
+}
+
+// unmarshal is a helper function that copies the values of data of the
+// fields read of the item to i
+func (s *Redis) unmarshal(ri *item, data map[string][]byte, i store.Item) error {
+	if len(ri.fields) == 0 {
+		return s.encoding().Unmarshal(data, i)
+	}
+	return s.encoding().UnmarshalFields(data, i, ri.fields)
+}
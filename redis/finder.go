@@ -0,0 +1,116 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// FindBy populates the slice dst with the items whose indexed field equals
+// value. Items of string and bool fields are found using a set for each
+// value, items of numeric fields using a sorted set scored by value.
+func (s *Redis) FindBy(field string, value interface{}, dst interface{}) error {
+	return s.FindByContext(context.Background(), field, value, dst)
+}
+
+// FindByContext is like FindBy but gives up acquiring a connection when ctx
+// is done.
+func (s *Redis) FindByContext(ctx context.Context, field string, value interface{}, dst interface{}) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	x, err := store.LookupIndex(sl.Type(), field)
+	if err != nil {
+		return err
+	}
+	b, err := x.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	if x.Numeric {
+		score, err := x.Score(b)
+		if err != nil {
+			return err
+		}
+		return s.find(ctx, sl, "ZREM", "ZRANGEBYSCORE", s.indexKey(sl.Type(), x, nil), score, score)
+	}
+	return s.find(ctx, sl, "SREM", "SMEMBERS", s.indexKey(sl.Type(), x, b))
+}
+
+// FindRange populates the slice dst with the items whose numeric indexed
+// field is between min and max inclusive, ordered by the field value.
+func (s *Redis) FindRange(field string, min, max float64, dst interface{}) error {
+	return s.FindRangeContext(context.Background(), field, min, max, dst)
+}
+
+// FindRangeContext is like FindRange but gives up acquiring a connection
+// when ctx is done.
+func (s *Redis) FindRangeContext(ctx context.Context, field string, min, max float64, dst interface{}) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	x, err := store.LookupIndex(sl.Type(), field)
+	if err != nil {
+		return err
+	}
+	if !x.Numeric {
+		return store.ErrNotIndexed
+	}
+	return s.find(ctx, sl, "ZREM", "ZRANGEBYSCORE", s.indexKey(sl.Type(), x, nil), min, max)
+}
+
+// find is a helper function that populates the slice sl with the items
+// whose keys are returned by the index command, whose first argument is the
+// key of the index. The entries of the items that are not found are removed
+// from the index with rem, SREM or ZREM.
+func (s *Redis) find(ctx context.Context, sl *store.Slice, rem, cmd string, args ...interface{}) error {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	keys, err := driver.Strings(c.Do(cmd, args...))
+	if err != nil {
+		return err
+	}
+	if err := sl.SetKeys(keys); err != nil {
+		return err
+	}
+	err = s.readMultiple(ctx, c, sl, nil)
+	// Index entries of expired items remain after the item key expires,
+	// they are removed along with the items from the slice
+	if merr, ok := err.(store.MultiError); ok {
+		stale := driver.Args{}.Add(args[0])
+		for _, e := range merr {
+			if e.Err == store.ErrKeyNotFound {
+				stale = stale.Add(e.Key)
+			}
+		}
+		if len(stale) > 1 {
+			if _, err := c.Do(rem, stale...); err != nil {
+				return err
+			}
+		}
+	}
+	return sl.RemoveNotFound(err)
+}
+
+// indexKey returns the redis key of the index of the field of type t. The
+// keys of sets for string and bool fields end with the escaped value. Index
+// keys are prefixed with "_idx" so List doesn't mistake them for items.
+func (s *Redis) indexKey(t reflect.Type, x store.Index, value []byte) string {
+	if x.Numeric {
+		return s.nameInNamespace("_idx", store.CollectionName(t), x.Field)
+	}
+	return s.nameInNamespace("_idx", store.CollectionName(t), x.Field, string(value))
+}
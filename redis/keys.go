@@ -0,0 +1,86 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultSeparator is the separator of the parts of redis keys used when
+// Config.Separator is empty
+const DefaultSeparator = ":"
+
+// errInvalidSeparator means that the separator configured can't be escaped
+var errInvalidSeparator = errors.New("store: separator must not contain '%'")
+
+// escape is a helper function that escapes the part of a redis key, so it
+// doesn't contain the separator sep. The escape character '%' and the bytes
+// of the separator are percent-encoded, parts without them are unchanged.
+func escape(part, sep string) string {
+	if !strings.Contains(part, "%") && !strings.Contains(part, sep) {
+		return part
+	}
+	var encoded string
+	for n := 0; n < len(sep); n++ {
+		encoded += fmt.Sprintf("%%%02X", sep[n])
+	}
+	part = strings.Replace(part, "%", "%25", -1)
+	return strings.Replace(part, sep, encoded, -1)
+}
+
+// keyPart is a helper function that returns the item key as it is part of
+// redis keys, escaped when escapeKey is set
+func keyPart(key, sep string, escapeKey bool) string {
+	if !escapeKey {
+		return key
+	}
+	return escape(key, sep)
+}
+
+// unescape is a helper function that reverses escape
+func unescape(part string) (string, error) {
+	if !strings.Contains(part, "%") {
+		return part, nil
+	}
+	return url.PathUnescape(part)
+}
+
+// matchPrefix is a helper function that returns the SCAN pattern matching
+// the keys starting with prefix. The glob characters in prefix are escaped.
+func matchPrefix(prefix string) string {
+	var b bytes.Buffer
+	for _, r := range prefix {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('*')
+	return b.String()
+}
+
+// trimKeys is a helper function that removes the prefix from the redis keys
+// and unescapes the item keys that remain when the store escapes keys. Keys
+// that are not escaped, such as keys written before the store escaped keys,
+// are left out, as their items can't be read by the store.
+func (s *Redis) trimKeys(keys []string, prefix string) []string {
+	trimmed := keys[:0]
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, prefix)
+		if s.escape {
+			var err error
+			if key, err = unescape(key); err != nil {
+				continue
+			}
+		}
+		trimmed = append(trimmed, key)
+	}
+	return trimmed
+}
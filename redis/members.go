@@ -0,0 +1,130 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// idsKey returns the redis key of the sorted set of the ids of the items of
+// type t scored by their creation time. It is prefixed with "_ids" so List
+// doesn't mistake it for an item.
+func (s *Redis) idsKey(t reflect.Type) string {
+	return s.nameInNamespace("_ids", store.CollectionName(t))
+}
+
+// sendMember is a helper function that queues the command adding the item
+// to the sorted set of ids of its type, or removing it when the item is
+// deleted. Items that are written again keep their creation time.
+func (s *Redis) sendMember(c driver.Conn, ri *item, deleted bool) error {
+	if deleted {
+		return c.Send("ZREM", s.idsKey(ri.typ), ri.key)
+	}
+	return c.Send("ZADD", s.idsKey(ri.typ), "NX", created(), ri.key)
+}
+
+// created is a helper function that returns the score of the items created
+// now, the milliseconds since the Unix epoch
+func created() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// live is a helper function that returns the ids of the sorted set set
+// whose items exist, the keys of the items start with prefix. The ids of
+// items that expired are removed from the set.
+func (s *Redis) live(c driver.Conn, prefix, set string, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return keys, nil
+	}
+	for _, key := range keys {
+		if err := c.Send("EXISTS", prefix+keyPart(key, s.sep, s.escape)); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := driver.Values(c.Do(""))
+	if err != nil {
+		return nil, err
+	}
+	live := keys[:0]
+	stale := driver.Args{}.Add(set)
+	for n, key := range keys {
+		if ok, _ := driver.Bool(reply[n], nil); ok {
+			live = append(live, key)
+		} else {
+			stale = stale.Add(key)
+		}
+	}
+	if len(stale) > 1 {
+		if _, err := c.Do("ZREM", stale...); err != nil {
+			return nil, err
+		}
+	}
+	return live, nil
+}
+
+// members is a helper function that returns the members of the member and
+// score pairs of a ZSCAN reply
+func members(pairs []string) []string {
+	keys := make([]string, 0, len(pairs)/2)
+	for n := 0; n < len(pairs); n += 2 {
+		keys = append(keys, pairs[n])
+	}
+	return keys
+}
+
+// Reindex builds the sorted set of the ids of the type of i from a SCAN of
+// the keyspace, for items written before the store maintained it. The ids of
+// items not in the set are added with the current time as their creation
+// time, and the ids of items that no longer exist are removed. It returns
+// the number of ids in the set.
+func (s *Redis) Reindex(i store.Item) (int, error) {
+	tmpl := s.newItem(i)
+	c := s.pool.Get()
+	defer c.Close()
+
+	prefix := tmpl.prefix + s.sep
+	keys, err := s.scan(context.Background(), c, matchPrefix(prefix))
+	if err != nil {
+		return 0, err
+	}
+	keys = s.trimKeys(keys, prefix)
+	idsKey := s.idsKey(tmpl.typ)
+	score := created()
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > MaxItems {
+			n = MaxItems
+		}
+		args := driver.Args{}.Add(idsKey, "NX")
+		for _, key := range keys[:n] {
+			args = args.Add(score, key)
+		}
+		if _, err := c.Do("ZADD", args...); err != nil {
+			return 0, err
+		}
+		keys = keys[n:]
+	}
+
+	// Remove the ids of items deleted before the store maintained the set
+	var cursor int64
+	for {
+		next, pairs, err := scanPage(c, "ZSCAN", idsKey, cursor, "COUNT", MaxItems)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.live(c, prefix, idsKey, members(pairs)); err != nil {
+			return 0, err
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return driver.Int(c.Do("ZCARD", idsKey))
+}
@@ -5,11 +5,12 @@
 package redis
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,14 +33,60 @@ var DefaultRedisURL = "redis://@127.0.0.1:6379"
 
 // item represent the data structure used to store values in redis.
 type item struct {
-	prefix string
-	key    string
-	data   map[string]interface{}
+	// prefix is the escaped collection name in the namespace, sep the
+	// separator of the parts of redis keys. The key is escaped in redis
+	// keys when escapeKey is set.
+	prefix    string
+	sep       string
+	escapeKey bool
+	key       string
+	data      map[string][]byte
+	// typ is the struct type of the item and indexes its indexed fields
+	typ     reflect.Type
+	indexes []store.Index
+	// ttl is the time to live of items that implement store.Expirer
+	expirer bool
+	ttl     time.Duration
+	// versioner is set for items that implement store.Versioner, version
+	// is the stored version read before the item is written
+	versioner store.Versioner
+	version   int64
+	// merge is set when the data is merged into the stored hash instead
+	// of replacing it, exists reports whether the hash exists
+	merge  bool
+	exists bool
+	// old holds the stored values of the indexed fields, read before
+	// the item is overwritten or deleted
+	old map[string][]byte
+	// codec encodes items stored as documents instead of hashes, doc is
+	// the encoded item. The versions of versioned documents are stored
+	// under keys prefixed with versionPrefix.
+	codec         store.Codec
+	doc           []byte
+	versionPrefix string
+	// fields are the fields read, all fields are read when empty
+	fields []store.Field
 }
 
 // Key returns the redis key used to store a redis item by prefix the item type.
 func (i *item) Key() string {
-	return i.prefix + ":" + i.key
+	return i.prefix + i.sep + keyPart(i.key, i.sep, i.escapeKey)
+}
+
+// validate returns the error of the key of the item, see store.ValidateKey,
+// or store.ErrEmptyCollection when the type of the item has no collection
+// name.
+func (i *item) validate() error {
+	if err := store.ValidateCollection(i.typ); err != nil {
+		return err
+	}
+	return store.ValidateKey(i.key)
+}
+
+// versionKey returns the redis key used to store the version of items
+// stored as documents.
+func (i *item) versionKey() string {
+	return i.versionPrefix + i.sep + keyPart(i.key, i.sep, i.escapeKey)
 }
 
 // Config stores the configuration values used for establishing a
@@ -49,15 +96,59 @@ type Config struct {
 	Db               int
 	// Namespace for redis
 	Namespace string
+	// Separator separates the namespace, the collection name and the item
+	// key in redis keys, DefaultSeparator is used when empty. Occurrences
+	// of the separator in collection names are escaped, the namespace is
+	// used as is.
+	Separator string
+	// EscapeKeys escapes the separator and '%' in item keys, so that the
+	// redis keys of items can be split into their parts, such as
+	// "Account:a%3Ab" for the key "a:b". Item keys are used as is when
+	// false, as they were before keys could be escaped. Existing items
+	// whose keys contain the separator or '%' are not found once it is
+	// enabled, until they are written again.
+	EscapeKeys bool
+	// BatchSize is the max number of items WriteMultiple sends in a
+	// single MULTI/EXEC block. All items are sent in one block when zero.
+	BatchSize int
+	// Members reads the ids of List and ListPage from the sorted set of the
+	// ids of each item type instead of scanning the keyspace. The sets are
+	// scored by creation time and maintained by all stores, which read
+	// them in ListSorted. The sets of items written before are built by
+	// Reindex.
+	Members bool
+	// Encoding converts items to and from hash fields, including how
+	// nested values are stored. store.DefaultEncoding is used when nil.
+	Encoding *store.Encoding
+	// Document stores items as a single document under their key instead
+	// of a hash, the stored fields of the item encoded with the codec, such
+	// as store.JSON or store.Gob, see store.MarshalDocument. Items are
+	// stored as hashes when nil. Gob doesn't store zero values, so pointer
+	// fields to zero values are read as nil pointers.
+	Document store.Codec
+	// DocumentTypes overrides Document for the item types by collection
+	// name, see store.CollectionName. Types mapped to nil are stored as
+	// hashes.
+	DocumentTypes map[string]store.Codec
 }
 
 // Redis implements represents the Store methods implemention for Redis.
 type Redis struct {
 	pool      *driver.Pool
 	namespace string
+	batchSize int
+	sep       string
+	escape    bool
+	members   bool
+	enc       *store.Encoding
+	// document and documentTypes are the codecs of items stored as
+	// documents
+	document      store.Codec
+	documentTypes map[string]store.Codec
 }
 
-// New returns a new Redis with defaults
+// New returns a new Redis with defaults. It returns an error when the
+// separator configured contains '%', which escapes separators in keys.
 func New(config *Config) (r *Redis, err error) {
 	if config == nil {
 		config, err = NewConfig(DefaultRedisURL)
@@ -65,7 +156,25 @@ func New(config *Config) (r *Redis, err error) {
 			return nil, err
 		}
 	}
-	return &Redis{pool: NewPool(config), namespace: config.Namespace}, nil
+	sep := config.Separator
+	if len(sep) == 0 {
+		sep = DefaultSeparator
+	}
+	if strings.Contains(sep, "%") {
+		return nil, errInvalidSeparator
+	}
+	return &Redis{
+		pool:      NewPool(config),
+		namespace: config.Namespace,
+		batchSize: config.BatchSize,
+		sep:       sep,
+		escape:    config.EscapeKeys,
+		members:   config.Members,
+		enc:       config.Encoding,
+
+		document:      config.Document,
+		documentTypes: config.DocumentTypes,
+	}, nil
 }
 
 // NewStore returns an instance of Store. It parses the connection information from the connUrl provided
@@ -76,7 +185,7 @@ func NewStore(connURL, namespace string) (store.Store, error) {
 	if err != nil {
 		return &Redis{}, err
 	}
-	return &Redis{pool: NewPool(config), namespace: namespace}, nil
+	return &Redis{pool: NewPool(config), namespace: namespace, sep: DefaultSeparator}, nil
 }
 
 // NewConfig returns a default redis config. It parses the connection information from the connUrl provided
@@ -152,6 +261,33 @@ func NewPool(config *Config) *driver.Pool {
 	}
 }
 
+// conn returns a connection from the pool. It stops waiting for the pool and
+// returns the context error when ctx is done before a connection is acquired.
+func (s *Redis) conn(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// contexts that are never done don't need to wait in a goroutine
+	if ctx.Done() == nil {
+		c := s.pool.Get()
+		return c, c.Err()
+	}
+	ch := make(chan driver.Conn, 1)
+	go func() { ch <- s.pool.Get() }()
+	select {
+	case c := <-ch:
+		if err := c.Err(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	case <-ctx.Done():
+		// return the connection to the pool once it is acquired
+		go func() { (<-ch).Close() }()
+		return nil, ctx.Err()
+	}
+}
+
 // Pool returns a redis pool in use with the store.
 // It returns a new pool otherwise
 func (s *Redis) Pool() *driver.Pool {
@@ -163,62 +299,184 @@ func (s *Redis) Pool() *driver.Pool {
 
 // Read reads the item from redis store and copies the values to item
 // It Returns store.ErrKeyNotFound when no values are found for the key provided
-// and store.ErrKeyMissing when key is not provided. Unmarshalling id done using
-// driver provided redis.ScanStruct
+// and store.ErrKeyMissing when key is not provided. The hash fields are copied
+// to the item using the store.Encoding of the store
 func (s *Redis) Read(i store.Item) error {
-	c := s.pool.Get()
+	return s.ReadContext(context.Background(), i)
+}
+
+// ReadContext is like Read but gives up acquiring a connection when ctx is done.
+func (s *Redis) ReadContext(ctx context.Context, i store.Item) error {
+	return s.read(ctx, i, nil)
+}
+
+// ReadFields reads only the fields named of the item with HMGET, by their Go
+// name or the name they are stored under, and leaves its other fields
+// untouched. Flattened fields are read with HGETALL, and items stored as
+// documents with GET. It returns store.ErrUnknownField when the item has no
+// such field, and like Read, store.ErrKeyNotFound when no item is stored for
+// the key.
+func (s *Redis) ReadFields(i store.Item, fields ...string) error {
+	return s.ReadFieldsContext(context.Background(), i, fields...)
+}
+
+// ReadFieldsContext is like ReadFields but gives up acquiring a connection
+// when ctx is done.
+func (s *Redis) ReadFieldsContext(ctx context.Context, i store.Item, fields ...string) error {
+	projected, err := s.lookupFields(reflect.TypeOf(i), fields)
+	if err != nil {
+		return err
+	}
+	return s.read(ctx, i, projected)
+}
+
+// read is a helper function that reads the fields of the item, or all of
+// its fields when fields is empty
+func (s *Redis) read(ctx context.Context, i store.Item, fields []store.Field) error {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer c.Close()
 
-	value := reflect.ValueOf(i).Elem()
-	if len(i.Key()) == 0 {
-		return store.ErrEmptyKey
+	ri := s.newItem(i)
+	if err := ri.validate(); err != nil {
+		return err
 	}
-	ri := &item{
-		key:    i.Key(),
-		prefix: s.nameInNamespace(value.Type().Name()),
+	ri.fields = fields
+	// Read the remaining time to live in the same transaction for
+	// items that need it
+	_, hasTTL := i.(store.TTLSetter)
+	c.Send("MULTI")
+	if _, err := s.sendRead(c, ri, hasTTL); err != nil {
+		return err
 	}
-	reply, err := driver.Values(c.Do("HGETALL", ri.Key()))
+	replies, err := driver.Values(c.Do("EXEC"))
 	if err != nil {
 		return err
 	}
-	if len(reply) == 0 {
-		return store.ErrKeyNotFound
-	}
-	if err := driver.ScanStruct(reply, i); err != nil {
+	found, err := s.decode(ri, replies, i, hasTTL)
+	if err != nil {
 		return err
 	}
+	if !found {
+		return store.ErrKeyNotFound
+	}
 	return nil
 }
 
-// ReadMultiple gets the values from redis in a single call by pipelining
+// ReadMultiple gets the values from redis in a single call by pipelining. It
+// returns a store.MultiError with the items that are not found, have invalid
+// keys or fail to convert, the other items are read in that case.
 func (s *Redis) ReadMultiple(i interface{}) error {
-	v := reflect.ValueOf(i)
+	return s.ReadMultipleContext(context.Background(), i)
+}
+
+// ReadMultipleContext is like ReadMultiple but stops sending commands to the
+// pipeline when ctx is done.
+func (s *Redis) ReadMultipleContext(ctx context.Context, i interface{}) error {
+	return s.ReadMultipleFieldsContext(ctx, i)
+}
+
+// ReadMultipleFields is like ReadMultiple but reads only the fields named of
+// the items as ReadFields does, leaving their other fields untouched. Items
+// that fail are left untouched as well.
+func (s *Redis) ReadMultipleFields(dst interface{}, fields ...string) error {
+	return s.ReadMultipleFieldsContext(context.Background(), dst, fields...)
+}
 
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+// ReadMultipleFieldsContext is like ReadMultipleFields but stops sending
+// commands to the pipeline when ctx is done.
+func (s *Redis) ReadMultipleFieldsContext(ctx context.Context, dst interface{}, fields ...string) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	projected, err := s.lookupFields(sl.Type(), fields)
+	if err != nil {
+		return err
 	}
 
-	if v.Kind() != reflect.Slice {
-		return errors.New("store: value must be a a slice")
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer c.Close()
+	return s.readMultiple(ctx, c, sl, projected)
+}
 
-	c := s.pool.Get()
+// ReadKeys populates the slice dst with the items of keys in a single call by
+// pipelining, as ReadMultiple does. It returns a store.MultiError with the
+// keys that are not found, unless store.SkipMissing is passed. With the
+// store.Fields option, only the fields named are read.
+func (s *Redis) ReadKeys(keys []string, dst interface{}, opts ...store.ReadOption) error {
+	return s.ReadKeysContext(context.Background(), keys, dst, opts...)
+}
+
+// ReadKeysContext is like ReadKeys but stops sending commands to the
+// pipeline when ctx is done.
+func (s *Redis) ReadKeysContext(ctx context.Context, keys []string, dst interface{}, opts ...store.ReadOption) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	o := store.NewReadOptions(opts)
+	fields, err := s.lookupFields(sl.Type(), o.Fields)
+	if err != nil {
+		return err
+	}
+	if err := sl.SetKeys(keys); err != nil {
+		return err
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer c.Close()
+	err = s.readMultiple(ctx, c, sl, fields)
+	if o.SkipMissing {
+		return sl.RemoveNotFound(err)
+	}
+	return err
+}
 
-	var key string
+// readMultiple is a helper function that reads the fields of the items in
+// the slice sl using c, or all of their fields when fields is empty. It
+// returns a store.MultiError with the items that are not found, have invalid
+// keys or fail to convert, which are reset to their zero value unless only
+// some of their fields are read.
+func (s *Redis) readMultiple(ctx context.Context, c driver.Conn, sl *store.Slice, fields []store.Field) error {
 	var err error
-	prefix := s.typeName(v) + ":"
+	var errs store.MultiError
+	// Each item is read with HGETALL, or GET for documents, followed by
+	// PTTL when the items need their remaining time to live
+	hasTTL := reflect.PtrTo(sl.Type()).Implements(ttlSetterType)
+	ritems := make([]*item, sl.Len())
+	for y := range ritems {
+		ri := s.newItem(sl.Item(y))
+		if err := ri.validate(); err != nil {
+			errs = append(errs, store.ItemError{Index: y, Key: ri.key, Err: err})
+			continue
+		}
+		ri.fields = fields
+		ritems[y] = ri
+	}
 
-	// Using transactions to execute HGETALL in a pipeline.
+	// Using transactions to execute the reads in a pipeline.
 	// Mark the start of a transaction block.
 	// Subsequent commands will be queued for atomic execution.
 	c.Send("MULTI")
-	for y := 0; y < v.Len(); y++ {
-		if key = v.Index(y).Addr().MethodByName("Key").Call(nil)[0].String(); len(key) == 0 {
-			return store.ErrEmptyKey
+	var step int
+	for _, ri := range ritems {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if ri == nil {
+			continue
 		}
-		// Send writes the command to the connection's output buffer.
-		if err = c.Send("HGETALL", prefix+key); err != nil {
+		// Send writes the commands to the connection's output buffer.
+		if step, err = s.sendRead(c, ri, hasTTL); err != nil {
 			return err
 		}
 	}
@@ -234,86 +492,379 @@ func (s *Redis) ReadMultiple(i interface{}) error {
 		return err
 	}
 
-	replyValue := reflect.ValueOf(reply)
-	var values []interface{}
+	replies, err := driver.Values(reply, nil)
+	if err != nil {
+		return err
+	}
 	// Reply is a two dimentional array of interfaces. Iterate over the first
-	// dimension and scan each slice into destination interface type
-	for y := 0; y < replyValue.Len(); y++ {
-		itemPtrV := reflect.New(v.Type().Elem())
-		if values, err = driver.Values(replyValue.Index(y).Interface(), nil); err != nil {
+	// dimension and decode each item into destination interface type, items
+	// not found are reset to their zero value. Projected items are decoded
+	// in place to leave their other fields untouched.
+	for y, ri := range ritems {
+		if len(fields) > 0 {
+			if ri != nil {
+				found, err := s.decode(ri, replies[:step], sl.Item(y), hasTTL)
+				replies = replies[step:]
+				if err == nil && !found {
+					err = store.ErrKeyNotFound
+				}
+				if err != nil {
+					errs = append(errs, store.ItemError{Index: y, Key: ri.key, Err: err})
+				}
+			}
+			continue
+		}
+		it := sl.New()
+		if ri != nil {
+			found, err := s.decode(ri, replies[:step], it, hasTTL)
+			replies = replies[step:]
+			if err == nil && !found {
+				err = store.ErrKeyNotFound
+			}
+			if err != nil {
+				errs = append(errs, store.ItemError{Index: y, Key: ri.key, Err: err})
+				it = sl.New()
+			}
+		}
+		sl.Set(y, it)
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(a, b int) bool { return errs[a].Index < errs[b].Index })
+		return errs
+	}
+	return nil
+}
+
+// sendRead is a helper function that queues the commands reading the item:
+// HGETALL, HMGET of the fields read, or GET for documents, followed by PTTL
+// when hasTTL is set, the EXISTS of the hash read with HMGET and the GET of
+// the version of versioned documents. It returns the number of commands
+// queued.
+func (s *Redis) sendRead(c driver.Conn, ri *item, hasTTL bool) (int, error) {
+	var err error
+	switch {
+	case ri.codec != nil:
+		err = c.Send("GET", ri.Key())
+	case ri.hmget():
+		args := driver.Args{}.Add(ri.Key())
+		for _, f := range ri.fields {
+			args = args.Add(f.Name)
+		}
+		if ri.versioner != nil {
+			args = args.Add(versionField)
+		}
+		err = c.Send("HMGET", args...)
+	default:
+		err = c.Send("HGETALL", ri.Key())
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 1
+	if hasTTL {
+		if err := c.Send("PTTL", ri.Key()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	// HMGET doesn't tell a missing hash from missing fields
+	if ri.hmget() {
+		if err := c.Send("EXISTS", ri.Key()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if ri.codec != nil && ri.versioner != nil {
+		if err := c.Send("GET", ri.versionKey()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// decode is a helper function that copies the replies of the commands
+// queued by sendRead to i, along with its version and remaining time to
+// live. It reports whether the item was found, i is left untouched when it
+// wasn't.
+func (s *Redis) decode(ri *item, replies []interface{}, i store.Item, hasTTL bool) (bool, error) {
+	var version int64
+	if ri.codec == nil {
+		data, found, err := s.readHash(ri, replies)
+		if err != nil || !found {
+			return false, err
+		}
+		if version, err = versionOf(data); err != nil {
+			return false, err
+		}
+		if err := s.unmarshal(ri, data, i); err != nil {
+			return false, err
+		}
+	} else {
+		doc, err := driver.Bytes(replies[0], nil)
+		if err == driver.ErrNil {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if ri.versioner != nil {
+			version, err = driver.Int64(replies[len(replies)-1], nil)
+			if err != nil && err != driver.ErrNil {
+				return false, err
+			}
+		}
+		if err := store.UnmarshalDocument(ri.codec, doc, i, ri.fields); err != nil {
+			return false, err
+		}
+	}
+	// the key may not be part of the fields of items that implement
+	// store.Marshaler
+	i.SetKey(ri.key)
+	if v, ok := i.(store.Versioner); ok {
+		v.SetVersion(version)
+	}
+	if hasTTL {
+		pttl, err := driver.Int64(replies[1], nil)
+		if err != nil {
+			return false, err
+		}
+		i.(store.TTLSetter).SetTTL(ttl(pttl))
+	}
+	return true, nil
+}
+
+// hash is a helper function that converts the reply of HGETALL to a map of
+// field names to values
+func hash(reply interface{}) (map[string][]byte, error) {
+	values, err := driver.ByteSlices(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string][]byte, len(values)/2)
+	for n := 0; n+1 < len(values); n += 2 {
+		data[string(values[n])] = values[n+1]
+	}
+	return data, nil
+}
+
+// versionOf is a helper function that returns the version stored in the
+// hash data, or zero if the hash has no version
+func versionOf(data map[string][]byte) (int64, error) {
+	b, ok := data[versionField]
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+// ttlSetterType is the type of the store.TTLSetter interface
+var ttlSetterType = reflect.TypeOf((*store.TTLSetter)(nil)).Elem()
+
+// ttl is a helper function that converts the reply of PTTL to a duration.
+// Keys without an expiry have a zero time to live.
+func ttl(pttl int64) time.Duration {
+	if pttl < 0 {
+		return 0
+	}
+	return time.Duration(pttl) * time.Millisecond
+}
+
+// WriteMultiple writes multiple items i to the store in a single call by
+// pipelining. Like Write, it assigns a UUID to items with empty keys. Items are
+// written atomically in MULTI/EXEC blocks of at most Config.BatchSize items, or
+// in a single block when no batch size is configured. No items are written when
+// any of the items fail to convert, it returns a store.MultiError with those
+// items, as it does with the items of a batch that fail with store.ErrConflict.
+func (s *Redis) WriteMultiple(items []store.Item) error {
+	return s.WriteMultipleContext(context.Background(), items)
+}
+
+// WriteMultipleContext is like WriteMultiple but stops sending batches when
+// ctx is done. Batches that were already executed remain written.
+func (s *Redis) WriteMultipleContext(ctx context.Context, items []store.Item) error {
+	var errs store.MultiError
+	ritems := make([]*item, len(items))
+	for n, i := range items {
+		ri := s.newItem(i)
+		if len(ri.key) == 0 {
+			ri.key = uuid.New().String()
+		}
+		if err := ri.validate(); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: ri.key, Err: err})
+			continue
+		}
+		i.SetKey(ri.key)
+		if err := s.encode(ri, i); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: ri.key, Err: err})
+			continue
+		}
+		ritems[n] = ri
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	size := s.batchSize
+	if size <= 0 {
+		size = len(ritems)
+	}
+	for start := 0; start < len(ritems); start += size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + size
+		if end > len(ritems) {
+			end = len(ritems)
+		}
+		if err := s.writeBatch(c, ritems[start:end]); err == store.ErrConflict {
+			return conflicts(ritems[start:end], start)
+		} else if err != nil {
 			return err
 		}
-		driver.ScanStruct(values, itemPtrV.Interface())
-		v.Index(y).Set(itemPtrV.Elem())
 	}
 	return nil
 }
 
-// WriteMultiple writes multiple items i to the store.
-func (s *Redis) WriteMultiple(i []store.Item) error {
-	return errors.New("Implementation pending")
+// conflicts is a helper function that returns the store.MultiError of the
+// versioned items of a batch at offset that failed with store.ErrConflict.
+// The items whose version doesn't match the stored version are reported, or
+// all the versioned items when another client wrote them during the batch.
+func conflicts(ritems []*item, offset int) error {
+	var errs, versioned store.MultiError
+	for n, ri := range ritems {
+		if ri.versioner == nil {
+			continue
+		}
+		e := store.ItemError{Index: offset + n, Key: ri.key, Err: store.ErrConflict}
+		versioned = append(versioned, e)
+		if ri.versioner.Version() != ri.version {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) == 0 {
+		return versioned
+	}
+	return errs
 }
 
 // Write writes the item to the store. It constructs the key using the i.Key()
 // and prefixes it with the type of struct. When the key is empty, it assigns
-// a unique universal id(UUID) using the SetKey method of the Item
+// a unique universal id(UUID) using the SetKey method of the Item. The values
+// stored for the key are replaced atomically, fields that are no longer part
+// of the item are removed.
 func (s *Redis) Write(i store.Item) error {
-	c := s.pool.Get()
-	defer c.Close()
-
-	value := reflect.ValueOf(i).Elem()
+	return s.WriteContext(context.Background(), i)
+}
 
-	ri := &item{
-		prefix: s.typeName(value),
-		data:   make(map[string]interface{}),
+// WriteContext is like Write but gives up acquiring a connection when ctx is done.
+func (s *Redis) WriteContext(ctx context.Context, i store.Item) error {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer c.Close()
+
+	ri := s.newItem(i)
 
 	// Use the Items id if set or generate
 	// a new UUID
-	ri.key = i.Key()
 	if len(ri.key) == 0 {
 		ri.key = uuid.New().String()
 	}
+	if err := ri.validate(); err != nil {
+		return err
+	}
 	i.SetKey(ri.key)
 
 	// convert the item to redis item
-	if err := marshall(value, ri); err != nil {
+	if err := s.encode(ri, i); err != nil {
 		return err
 	}
+	return s.writeBatch(c, []*item{ri})
+}
 
-	for key, val := range ri.data {
-		if err := c.Send("HSET", ri.Key(), key, val); err != nil {
-			return err
-		}
-		c.Flush()
+// Patch writes the fields of the item over the values stored for its key,
+// leaving stored fields that are not part of the item in place. Items stored
+// as documents are replaced as a whole. When the key is empty, it returns a
+// store.ErrEmptyKey error. When the key does not exist, it returns a
+// store.ErrKeyNotFound error.
+func (s *Redis) Patch(i store.Item) error {
+	return s.PatchContext(context.Background(), i)
+}
+
+// PatchContext is like Patch but gives up acquiring a connection when ctx is
+// done.
+func (s *Redis) PatchContext(ctx context.Context, i store.Item) error {
+	ri := s.newItem(i)
+	if err := ri.validate(); err != nil {
+		return err
 	}
+	if err := s.encode(ri, i); err != nil {
+		return err
+	}
+	ri.merge = true
 
-	return nil
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return s.writeBatch(c, []*item{ri})
 }
 
 // DeleteMultiple deletes multiple items i from the store. It returns the count
-// of items successfully deleted. It returns an error if any of the items do
-// not exist or can't be deleted. It will delete the other items, in that case.
+// of items successfully deleted. It returns a store.MultiError with the items
+// that do not exist or have invalid keys, it will delete the other items in
+// that case.
 func (s *Redis) DeleteMultiple(items []store.Item) (int, error) {
-	c := s.pool.Get()
-	defer c.Close()
+	return s.DeleteMultipleContext(context.Background(), items)
+}
 
-	keys := make([]interface{}, len(items))
-	for i, item := range items {
-		value := reflect.ValueOf(item).Elem()
-		if len(item.Key()) > 0 {
-			keys[i] = fmt.Sprintf("%s:%s", s.typeName(value), item.Key())
+// DeleteMultipleContext is like DeleteMultiple but gives up acquiring a
+// connection when ctx is done.
+func (s *Redis) DeleteMultipleContext(ctx context.Context, items []store.Item) (int, error) {
+	var errs store.MultiError
+	ritems := make([]*item, 0, len(items))
+	index := make([]int, 0, len(items))
+	for n, i := range items {
+		ri := s.newItem(i)
+		if err := ri.validate(); err != nil {
+			errs = append(errs, store.ItemError{Index: n, Key: ri.key, Err: err})
+			continue
 		}
+		ritems = append(ritems, ri)
+		index = append(index, n)
 	}
 
-	count, err := driver.Int(c.Do("DEL", keys...))
-	if err != nil {
-		return 0, err
+	var count int
+	// DEL expects at least one key
+	if len(ritems) > 0 {
+		c, err := s.conn(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+
+		if count, err = s.deleteBatch(c, ritems); err != nil {
+			return 0, err
+		}
 	}
-	if count != len(keys) {
-		return count, store.ErrKeyNotFound
+	for n, ri := range ritems {
+		if !ri.exists {
+			errs = append(errs, store.ItemError{Index: index[n], Key: ri.key, Err: store.ErrKeyNotFound})
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(a, b int) bool { return errs[a].Index < errs[b].Index })
+		return count, errs
 	}
-
 	return count, nil
 }
 
@@ -321,21 +872,23 @@ func (s *Redis) DeleteMultiple(items []store.Item) (int, error) {
 // When the key is empty, it returns a store.ErrEmptyKey error. When the key
 // does not exist, it returns a store.ErrKeyNotFound error.
 func (s *Redis) Delete(i store.Item) error {
-	c := s.pool.Get()
-	defer c.Close()
-
-	value := reflect.ValueOf(i).Elem()
+	return s.DeleteContext(context.Background(), i)
+}
 
-	ri := &item{
-		prefix: s.typeName(value),
+// DeleteContext is like Delete but gives up acquiring a connection when ctx is done.
+func (s *Redis) DeleteContext(ctx context.Context, i store.Item) error {
+	ri := s.newItem(i)
+	if err := ri.validate(); err != nil {
+		return err
 	}
 
-	ri.key = i.Key()
-	if len(ri.key) == 0 {
-		return store.ErrEmptyKey
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer c.Close()
 
-	count, err := driver.Int(c.Do("DEL", ri.Key()))
+	count, err := s.deleteBatch(c, []*item{ri})
 	if err != nil {
 		return err
 	}
@@ -348,128 +901,216 @@ func (s *Redis) Delete(i store.Item) error {
 
 // List populates the slice with ids of the slice element type.
 func (s *Redis) List(i interface{}) error {
-	v := reflect.ValueOf(i)
-	// Get the elements of the interface if its a pointer
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
+	return s.ListContext(context.Background(), i)
+}
 
-	if v.Kind() != reflect.Slice {
-		return errors.New("store: value must be a a slice")
+// ListContext is like List but stops scanning the keyspace when ctx is done.
+func (s *Redis) ListContext(ctx context.Context, i interface{}) error {
+	sl, err := store.NewSlice(i)
+	if err != nil {
+		return err
 	}
 
-	c := s.pool.Get()
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer c.Close()
 
-	typeName := s.typeName(v)
-	var cursor int64
 	var keys []string
-
-	// Ideally, want to fetch in a go routine
-	for cursor >= 0 {
-		// SCAN return value is an array of two values: the first value
-		// is the new cursor to use in the next call, the second value
-		// is an array of elements.
-		reply, err := c.Do("SCAN", cursor, "MATCH", typeName+":*", "COUNT", MaxItems)
-		if err != nil {
+	var cursor int64
+	for {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		// Read the cursor bits, the driver provides them as
-		// an array of unsigned 8-bit integers
-		cursorBytes := reflect.ValueOf(reply).Index(0).Interface().([]uint8)
-
-		// Converting the []uint8 to int by converting to a string first, there
-		// is perhaps an optimal way but I could not figure out in go's constructs
-		if cursor, err = strconv.ParseInt(fmt.Sprintf("%s", cursorBytes), 10, 64); err != nil {
+		next, page, err := s.listPage(c, sl.Type(), cursor, MaxItems)
+		if err != nil {
 			return err
 		}
-		valueBytes := reflect.ValueOf(reply).Index(1).Interface().([]interface{})
-		values, _ := driver.Strings(valueBytes, nil)
-		keys = append(keys, values...)
+		keys = append(keys, page...)
 		// Break the loop when the no more records left to read (cursor is 0)
-		if cursor == 0 {
+		if cursor = next; cursor == 0 {
 			break
 		}
 	}
+	return sl.SetKeys(keys)
+}
 
-	// Format and copy the keys to interface and ensure the interface
-	// has the required length.
-	ensureSliceLen(v, len(keys))
-	for index, key := range keys {
-		// Remove the type of item from the key and just return the id
-		id := strings.TrimPrefix(key, typeName+":")
-		// value representing a pointer to a new zero value for the slice
-		// element type. Basically, initialize a new item struct
-		itemPtrV := reflect.New(v.Type().Elem())
-
-		// function value corresponding to the SetKey function of the Struct
-		setKeyFuncV := itemPtrV.MethodByName("SetKey")
+// ListPage populates the slice dst with ids of the slice element type,
+// scanning a page of the keyspace with SCAN from cursor, with limit as its
+// COUNT hint. It returns the SCAN cursor of the next page, or an empty
+// cursor after the last page. Pages have at least one id, except the last.
+func (s *Redis) ListPage(dst interface{}, cursor string, limit int) (string, error) {
+	return s.ListPageContext(context.Background(), dst, cursor, limit)
+}
 
-		// array of values representing string ids to pass to the SetKey function
-		setKeyFuncArgsV := []reflect.Value{reflect.ValueOf(id)}
+// ListPageContext is like ListPage but stops scanning the keyspace when ctx
+// is done.
+func (s *Redis) ListPageContext(ctx context.Context, dst interface{}, cursor string, limit int) (string, error) {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return "", err
+	}
+	var next int64
+	if len(cursor) > 0 {
+		if next, err = strconv.ParseInt(cursor, 10, 64); err != nil || next <= 0 {
+			return "", store.ErrInvalidCursor
+		}
+	}
+	if limit <= 0 {
+		limit = MaxItems
+	}
 
-		// call the SetKey function on the struct to store the key
-		setKeyFuncV.Call(setKeyFuncArgsV)
-		v.Index(index).Set(itemPtrV.Elem())
+	c, err := s.conn(ctx)
+	if err != nil {
+		return "", err
 	}
-	return nil
-}
+	defer c.Close()
 
-// ensureSliceLen is a helper function to ensure the length of the slice is n
-func ensureSliceLen(d reflect.Value, n int) {
-	if n > d.Cap() {
-		d.Set(reflect.MakeSlice(d.Type(), n, n))
-	} else {
-		d.SetLen(n)
+	var keys []string
+	// SCAN may return no keys before reaching the end of the keyspace,
+	// scanning goes on until it finds some
+	for len(keys) == 0 {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if next, keys, err = s.listPage(c, sl.Type(), next, limit); err != nil {
+			return "", err
+		}
+		if next == 0 {
+			break
+		}
+	}
+	if err := sl.SetKeys(keys); err != nil {
+		return "", err
+	}
+	if next == 0 {
+		return "", nil
 	}
+	return strconv.FormatInt(next, 10), nil
 }
 
-// typeName is a helper function to return the name of the type.
-func (s *Redis) typeName(value reflect.Value) string {
-	if value.Kind() == reflect.Slice {
-		return s.nameInNamespace(value.Type().Elem().Name())
+// listPage is a helper function that reads a page of the ids of the items
+// of type t from cursor. The ids are read from the sorted set of ids of the
+// type when the store maintains them, otherwise from a page of the keyspace.
+// It returns the cursor of the next page.
+func (s *Redis) listPage(c driver.Conn, t reflect.Type, cursor int64, count int) (int64, []string, error) {
+	prefix := s.typeName(t) + s.sep
+	if s.members {
+		next, pairs, err := scanPage(c, "ZSCAN", s.idsKey(t), cursor, "COUNT", count)
+		if err != nil {
+			return 0, nil, err
+		}
+		keys, err := s.live(c, prefix, s.idsKey(t), members(pairs))
+		return next, keys, err
+	}
+	next, keys, err := scanPage(c, "SCAN", cursor, "MATCH", matchPrefix(prefix), "COUNT", count)
+	if err != nil {
+		return 0, nil, err
 	}
-	return s.nameInNamespace(value.Type().Name())
+	// Remove the type of item from the keys and just return the ids
+	return next, s.trimKeys(keys, prefix), nil
 }
 
-// marshall is a helper function that copies the value to redis.item and converts
-// the struct field types to driver supported types
-func marshall(value reflect.Value, rItem *item) error {
-	// Ideally use the driver default marshalling redis.ConverAssignBytes
-	for i := 0; i < value.NumField(); i++ {
-		// key for data map
-		k := value.Type().Field(i).Name
-		field := value.Field(i)
-		// ignore unexported fields
-		if !field.CanSet() {
-			continue
+// scan is a helper function that returns the keys matching pattern, it
+// stops scanning the keyspace when ctx is done
+func (s *Redis) scan(ctx context.Context, c driver.Conn, pattern string) ([]string, error) {
+	var cursor int64
+	var keys []string
+
+	// Ideally, want to fetch in a go routine
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		switch field.Kind() {
-		case reflect.String:
-			rItem.data[k] = field.String()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			rItem.data[k] = strconv.FormatInt(field.Int(), 10)
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			rItem.data[k] = field.Uint()
-		case reflect.Float32, reflect.Float64:
-			rItem.data[k] = field.Float()
-		case reflect.Bool:
-			if field.Bool() {
-				rItem.data[k] = "1"
-			} else {
-				rItem.data[k] = "0"
-			}
-		default:
-			return fmt.Errorf("store: cannot convert %s (type: %s)", k, field.Kind())
+		next, values, err := scanPage(c, "SCAN", cursor, "MATCH", pattern, "COUNT", MaxItems)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, values...)
+		// Break the loop when the no more records left to read (cursor is 0)
+		if cursor = next; cursor == 0 {
+			break
 		}
 	}
-	return nil
+	return keys, nil
 }
 
-// nameInNamespace returns the item names with namespace prefixed
-func (s *Redis) nameInNamespace(name string) string {
+// scanPage is a helper function that sends the SCAN or ZSCAN command cmd
+// with args, it returns the cursor of the next page and the keys or members
+// of the page
+func scanPage(c driver.Conn, cmd string, args ...interface{}) (int64, []string, error) {
+	// SCAN return value is an array of two values: the first value
+	// is the new cursor to use in the next call, the second value
+	// is an array of elements.
+	reply, err := c.Do(cmd, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Read the cursor bits, the driver provides them as
+	// an array of unsigned 8-bit integers
+	cursorBytes := reflect.ValueOf(reply).Index(0).Interface().([]uint8)
+
+	// Converting the []uint8 to int by converting to a string first, there
+	// is perhaps an optimal way but I could not figure out in go's constructs
+	cursor, err := strconv.ParseInt(fmt.Sprintf("%s", cursorBytes), 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	valueBytes := reflect.ValueOf(reply).Index(1).Interface().([]interface{})
+	keys, _ := driver.Strings(valueBytes, nil)
+	return cursor, keys, nil
+}
+
+// typeName is a helper function to return the collection name of the item
+// type t in the namespace of the store.
+func (s *Redis) typeName(t reflect.Type) string {
+	return s.nameInNamespace(store.CollectionName(t))
+}
+
+// newItem is a helper function that returns the redis item for i, without
+// its data
+func (s *Redis) newItem(i store.Item) *item {
+	value := reflect.ValueOf(i).Elem()
+	ri := &item{
+		prefix:    s.typeName(value.Type()),
+		sep:       s.sep,
+		escapeKey: s.escape,
+		key:       i.Key(),
+		typ:       value.Type(),
+		indexes:   store.Indexes(value.Type()),
+	}
+	if e, ok := i.(store.Expirer); ok {
+		ri.expirer = true
+		ri.ttl = e.TTL()
+	}
+	if v, ok := i.(store.Versioner); ok {
+		ri.versioner = v
+	}
+	if ri.codec = s.documentCodec(ri.typ); ri.codec != nil && ri.versioner != nil {
+		ri.versionPrefix = s.nameInNamespace("_ver", store.CollectionName(ri.typ))
+	}
+	return ri
+}
+
+// encoding is a helper function that returns the encoding of the store
+func (s *Redis) encoding() *store.Encoding {
+	if s.enc == nil {
+		return store.DefaultEncoding
+	}
+	return s.enc
+}
+
+// nameInNamespace returns the redis key of the parts of the name, escaped
+// and joined by the separator, with the namespace prefixed. The namespace is
+// not escaped, so that namespaces such as "app:prod" keep their keys.
+func (s *Redis) nameInNamespace(parts ...string) string {
+	escaped := make([]string, 0, len(parts)+1)
 	if len(s.namespace) != 0 {
-		return s.namespace + ":" + name
+		escaped = append(escaped, s.namespace)
+	}
+	for _, part := range parts {
+		escaped = append(escaped, escape(part, s.sep))
 	}
-	return name
+	return strings.Join(escaped, s.sep)
 }
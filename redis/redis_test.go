@@ -5,12 +5,16 @@
 package redis
 
 import (
+	"context"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	driver "github.com/garyburd/redigo/redis"
 	"github.com/google/uuid"
 	"github.com/gosuri/go-store/store"
+	"github.com/gosuri/go-store/storetest"
 )
 
 var (
@@ -39,6 +43,120 @@ func (s *TestR) SetKey(k string) {
 	s.ID = k
 }
 
+func TestConformance(t *testing.T) {
+	storetest.RunConformance(t, func() store.Store {
+		db, err := NewStore(testRedisURL, uuid.New().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestConformanceMembers(t *testing.T) {
+	storetest.RunConformance(t, func() store.Store {
+		return testMembersStore(t)
+	})
+}
+
+// TestConformanceDocument runs the conformance tests against a store keeping
+// items as documents, which doesn't support updating fields in place
+func TestConformanceDocument(t *testing.T) {
+	storetest.RunConformanceExcept(t, func() store.Store {
+		return testDocumentStore(t, store.JSON)
+	}, "Updater")
+}
+
+func testMembersStore(t *testing.T) *Redis {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = uuid.New().String()
+	cfg.Members = true
+	cfg.EscapeKeys = true
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestReindex(t *testing.T) {
+	db := testMembersStore(t)
+	c := db.Pool().Get()
+	defer c.Close()
+	idsKey := db.idsKey(reflect.TypeOf(storetest.Session{}))
+
+	// items written before the store maintained the set of ids
+	a := &storetest.Session{ID: "a", User: "ada"}
+	b := &storetest.Session{ID: "b", User: "alan"}
+	b.SetTTL(time.Millisecond)
+	if err := db.WriteMultiple([]store.Item{a, b}); err != nil {
+		t.Fatal("err", err)
+	}
+	if _, err := c.Do("DEL", idsKey); err != nil {
+		t.Fatal("err", err)
+	}
+	var list []storetest.Session
+	if err := db.List(&list); err != nil || len(list) != 0 {
+		t.Fatal("expected an empty list before Reindex, got: ", list, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := db.Reindex(a); err != nil || n != 1 {
+		t.Fatal("expected 1 id, got: ", n, err)
+	}
+	if err := db.List(&list); err != nil || len(list) != 1 || list[0].ID != "a" {
+		t.Fatal("expected [a], got: ", list, err)
+	}
+
+	// the ids of items deleted without maintaining the set are removed
+	if _, err := c.Do("DEL", db.newItem(a).Key()); err != nil {
+		t.Fatal("err", err)
+	}
+	if n, err := db.Reindex(a); err != nil || n != 0 {
+		t.Fatal("expected 0 ids, got: ", n, err)
+	}
+}
+
+// testExpiring is an indexed item that expires
+type testExpiring struct {
+	ID   string
+	Name string `store:",index"`
+	Age  int    `store:",index"`
+}
+
+func (x *testExpiring) Key() string        { return x.ID }
+func (x *testExpiring) SetKey(k string)    { x.ID = k }
+func (x *testExpiring) TTL() time.Duration { return time.Millisecond }
+
+func TestFindRemovesExpired(t *testing.T) {
+	db := testMembersStore(t)
+	if err := db.Write(&testExpiring{ID: "a", Name: "ada", Age: 36}); err != nil {
+		t.Fatal("err", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var got []testExpiring
+	if err := db.FindBy("Name", "ada", &got); err != nil || len(got) != 0 {
+		t.Fatal("expected no items, got: ", got, err)
+	}
+	if err := db.FindRange("Age", 0, 100, &got); err != nil || len(got) != 0 {
+		t.Fatal("expected no items, got: ", got, err)
+	}
+	c := db.Pool().Get()
+	defer c.Close()
+	typ := reflect.TypeOf(testExpiring{})
+	name, _ := store.LookupIndex(typ, "Name")
+	age, _ := store.LookupIndex(typ, "Age")
+	if n, err := driver.Int(c.Do("SCARD", db.indexKey(typ, name, []byte("ada")))); err != nil || n != 0 {
+		t.Fatal("expected the entry of the expired item to be removed, got: ", n, err)
+	}
+	if n, err := driver.Int(c.Do("ZCARD", db.indexKey(typ, age, nil))); err != nil || n != 0 {
+		t.Fatal("expected the entry of the expired item to be removed, got: ", n, err)
+	}
+}
+
 func TestWrite(t *testing.T) {
 	s := &TestR{
 		ID:         uuid.New().String(),
@@ -83,6 +201,38 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWriteReplaces(t *testing.T) {
+	db := testStore(t)
+	s := &TestR{Field: "value"}
+	if err := db.Write(s); err != nil {
+		t.Fatal("err", err)
+	}
+
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewPool(cfg).Get()
+	defer c.Close()
+	key := testNs + ":TestR:" + s.Key()
+	if _, err := c.Do("HSET", key, "Removed", "stale"); err != nil {
+		t.Fatal("err", err)
+	}
+
+	if err := db.(store.Patcher).Patch(s); err != nil {
+		t.Fatal("err", err)
+	}
+	if ok, err := driver.Bool(c.Do("HEXISTS", key, "Removed")); err != nil || !ok {
+		t.Fatal("expected Patch to keep the stale field, got: ", ok, err)
+	}
+	if err := db.Write(s); err != nil {
+		t.Fatal("err", err)
+	}
+	if ok, err := driver.Bool(c.Do("HEXISTS", key, "Removed")); err != nil || ok {
+		t.Fatal("expected Write to remove the stale field, got: ", ok, err)
+	}
+}
+
 func BenchmarkRedisWrite(b *testing.B) {
 	db := testStoreB(b)
 	for i := 0; i < b.N; i++ {
@@ -90,6 +240,366 @@ func BenchmarkRedisWrite(b *testing.B) {
 	}
 }
 
+func TestWriteMultiple(t *testing.T) {
+	db := testStore(t)
+	s := &TestR{ID: uuid.New().String(), Field: "value", FieldInt: 10}
+	s1 := &TestR{Field: "value1", FieldBool: true}
+
+	if err := db.WriteMultiple([]store.Item{s, s1}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	if len(s1.Key()) == 0 {
+		t.Fatalf("key is emtpy %#v", s1)
+	}
+
+	got := []TestR{{ID: s.Key()}, {ID: s1.Key()}}
+	if err := db.ReadMultiple(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []TestR{*s, *s1}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+}
+
+func TestWriteMultipleBatches(t *testing.T) {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = testNs
+	cfg.BatchSize = 2
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := make([]store.Item, 5)
+	for i := range items {
+		items[i] = &TestR{Field: "batch", FieldInt: i}
+	}
+	if err := db.WriteMultiple(items); err != nil {
+		t.Fatal("err", err)
+	}
+
+	for i, item := range items {
+		got := &TestR{ID: item.Key()}
+		if err := db.Read(got); err != nil {
+			t.Fatal("err", err)
+		}
+		if got.FieldInt != i {
+			t.Fatalf("expected FieldInt to be %d, got: %d", i, got.FieldInt)
+		}
+	}
+}
+
+func TestEncodingFlatten(t *testing.T) {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = testNs
+	cfg.Encoding = &store.Encoding{Codec: store.Gob, Flatten: true}
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &storetest.Profile{
+		Home: &storetest.Address{City: "Paris"},
+		Tags: []string{"a"},
+		Meta: map[string]string{"color": "red"},
+	}
+	if err := db.Write(p); err != nil {
+		t.Fatal("err", err)
+	}
+	c := db.Pool().Get()
+	defer c.Close()
+	city, err := driver.String(c.Do("HGET", testNs+":Profile:"+p.Key(), "Home.City"))
+	if err != nil || city != "Paris" {
+		t.Fatal("expected Home.City to be stored, got: ", city, err)
+	}
+
+	got := &storetest.Profile{Base: storetest.Base{ID: p.Key()}}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", p, got)
+	}
+
+	// flattened fields are read with their dotted fields
+	got = &storetest.Profile{Base: storetest.Base{ID: p.Key()}, Tags: []string{"kept"}}
+	if err := db.ReadFields(got, "Home", "Meta"); err != nil {
+		t.Fatal("err", err)
+	}
+	exp := &storetest.Profile{Base: storetest.Base{ID: p.Key()}, Home: p.Home, Tags: []string{"kept"}, Meta: p.Meta}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Separator = "%"
+	if _, err := New(cfg); err != errInvalidSeparator {
+		t.Fatal("expected errInvalidSeparator, got: ", err)
+	}
+	cfg.Namespace = uuid.New().String()
+	cfg.Separator = "/"
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys are used as is by default
+	r := &TestR{ID: "a/b:100%", Field: "value"}
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	c := db.Pool().Get()
+	defer c.Close()
+	key := cfg.Namespace + "/TestR/a/b:100%"
+	if ok, err := driver.Bool(c.Do("EXISTS", key)); err != nil || !ok {
+		t.Fatal("expected the item to be stored at ", key, err)
+	}
+	var list []TestR
+	if err := db.List(&list); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(list) != 1 || list[0].ID != r.ID {
+		t.Fatalf("expected [%q], got: %v", r.ID, list)
+	}
+
+	// escaped keys are listed along with the keys written before that
+	// can be unescaped, the others are left out
+	cfg.EscapeKeys = true
+	if db, err = New(cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.ID = "c/d:100%"
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	key = cfg.Namespace + "/TestR/c%2Fd:100%25"
+	if ok, err := driver.Bool(c.Do("EXISTS", key)); err != nil || !ok {
+		t.Fatal("expected the item to be stored at ", key, err)
+	}
+	if _, err := c.Do("HSET", cfg.Namespace+"/TestR/e", "ID", "e"); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.List(&list); err != nil {
+		t.Fatal("err", err)
+	}
+	var ids []string
+	for _, x := range list {
+		ids = append(ids, x.ID)
+	}
+	sort.Strings(ids)
+	if exp := []string{"c/d:100%", "e"}; !reflect.DeepEqual(ids, exp) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", exp, ids)
+	}
+
+	// namespaces are not escaped
+	cfg.Namespace = "app/" + uuid.New().String()
+	if db, err = New(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	key = cfg.Namespace + "/TestR/c%2Fd:100%25"
+	if ok, err := driver.Bool(c.Do("EXISTS", key)); err != nil || !ok {
+		t.Fatal("expected the item to be stored at ", key, err)
+	}
+	if err := db.List(&list); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(list) != 1 || list[0].ID != r.ID {
+		t.Fatalf("expected [%q], got: %v", r.ID, list)
+	}
+}
+
+func TestListPageInvalidCursor(t *testing.T) {
+	db, err := NewStore(testRedisURL, testNs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page []TestR
+	for _, cursor := range []string{"x", "0", "-1"} {
+		if _, err := db.(store.Pager).ListPage(&page, cursor, 10); err != store.ErrInvalidCursor {
+			t.Fatalf("cursor %q: expected ErrInvalidCursor, got: %v", cursor, err)
+		}
+	}
+}
+
+func testDocumentStore(t *testing.T, codec store.Codec) *Redis {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = uuid.New().String()
+	cfg.Document = codec
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDocument(t *testing.T) {
+	for _, codec := range []store.Codec{store.JSON, store.Gob} {
+		db := testDocumentStore(t, codec)
+		x := &storetest.Indexed{Name: "alan", Age: 41}
+		y := &storetest.Indexed{Name: "grace", Age: 85}
+		if err := db.WriteMultiple([]store.Item{x, y}); err != nil {
+			t.Fatal("err", err)
+		}
+		c := db.Pool().Get()
+		typ, err := driver.String(c.Do("TYPE", db.namespace+":Indexed:"+x.Key()))
+		doc, _ := driver.String(c.Do("GET", db.namespace+":Indexed:"+x.Key()))
+		c.Close()
+		if err != nil || typ != "string" {
+			t.Fatal("expected a string key, got: ", typ, err)
+		}
+		// the values of JSON documents are readable by other consumers
+		exp := `{"ID":"` + x.Key() + `","Name":"alan","Age":41,"Score":0,"Note":""}`
+		if codec == store.JSON && doc != exp {
+			t.Fatalf("Mismatch\nexp: %s \ngot: %s", exp, doc)
+		}
+
+		got := &storetest.Indexed{ID: x.Key()}
+		if err := db.Read(got); err != nil {
+			t.Fatal("err", err)
+		}
+		if !reflect.DeepEqual(got, x) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, got)
+		}
+		var all []storetest.Indexed
+		if err := db.List(&all); err != nil {
+			t.Fatal("err", err)
+		}
+		if err := db.ReadMultiple(all); err != nil {
+			t.Fatal("err", err)
+		}
+		if len(all) != 2 || all[0].Name == "" || all[1].Name == "" {
+			t.Fatalf("expected 2 items, got: %#v", all)
+		}
+		projected := &storetest.Indexed{ID: x.Key(), Note: "kept"}
+		if err := db.ReadFields(projected, "Age"); err != nil {
+			t.Fatal("err", err)
+		}
+		if exp := (&storetest.Indexed{ID: x.Key(), Age: x.Age, Note: "kept"}); !reflect.DeepEqual(projected, exp) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, projected)
+		}
+
+		// index entries are replaced when the document is
+		x.Age = 42
+		if err := db.Write(x); err != nil {
+			t.Fatal("err", err)
+		}
+		var found []storetest.Indexed
+		if err := db.FindRange("Age", 40, 50, &found); err != nil {
+			t.Fatal("err", err)
+		}
+		if len(found) != 1 || found[0].Age != 42 {
+			t.Fatalf("expected alan, got: %#v", found)
+		}
+
+		if _, err := db.Increment(x, "Age", 1); err != ErrDocument {
+			t.Fatal("expected ErrDocument, got: ", err)
+		}
+		if err := db.Delete(x); err != nil {
+			t.Fatal("err", err)
+		}
+		if err := db.Read(&storetest.Indexed{ID: x.Key()}); err != store.ErrKeyNotFound {
+			t.Fatal("expected ErrKeyNotFound, got: ", err)
+		}
+	}
+}
+
+func TestDocumentVersion(t *testing.T) {
+	db := testDocumentStore(t, store.JSON)
+	a := &storetest.Account{Balance: 10}
+	if err := db.Write(a); err != nil {
+		t.Fatal("err", err)
+	}
+	stale := &storetest.Account{ID: a.Key()}
+	if err := db.Read(stale); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Write(a); err != nil {
+		t.Fatal("err", err)
+	}
+	if a.Version() != 2 {
+		t.Fatal("expected version 2, got: ", a.Version())
+	}
+	if err := db.Write(stale); err != store.ErrConflict {
+		t.Fatal("expected ErrConflict, got: ", err)
+	}
+}
+
+func TestMigrateDocuments(t *testing.T) {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = uuid.New().String()
+	hashes, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &storetest.Account{Balance: 10}
+	if err := hashes.Write(a); err != nil {
+		t.Fatal("err", err)
+	}
+
+	cfg.DocumentTypes = map[string]store.Codec{"Account": store.JSON}
+	docs, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := docs.MigrateDocuments(&storetest.Account{}); err != nil || n != 1 {
+		t.Fatal("expected 1 item migrated, got: ", n, err)
+	}
+	if n, err := docs.MigrateDocuments(&storetest.Account{}); err != nil || n != 0 {
+		t.Fatal("expected no items migrated, got: ", n, err)
+	}
+	c := docs.Pool().Get()
+	doc, err := driver.String(c.Do("GET", cfg.Namespace+":Account:"+a.Key()))
+	c.Close()
+	if exp := `{"ID":"` + a.Key() + `","Balance":10}`; err != nil || doc != exp {
+		t.Fatalf("Mismatch\nexp: %s \ngot: %s %v", exp, doc, err)
+	}
+	got := &storetest.Account{ID: a.Key()}
+	if err := docs.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.Balance != 10 || got.Version() != 1 {
+		t.Fatalf("expected the migrated account, got: %#v", got)
+	}
+	if _, err := hashes.MigrateDocuments(&storetest.Account{}); err == nil {
+		t.Fatal("expected error migrating a type stored as hashes")
+	}
+}
+
+func benchmarkWriteMultiple(n int, b *testing.B) {
+	db := testStoreB(b)
+	items := make([]store.Item, n)
+	for i := range items {
+		items[i] = &TestR{Field: "BenchmarkWriteMultiple"}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.WriteMultiple(items)
+	}
+}
+
+func BenchmarkRedisWriteMultiple1k(b *testing.B) { benchmarkWriteMultiple(1000, b) }
+
 func TestRead(t *testing.T) {
 	s := &TestR{
 		ID:    uuid.New().String(),
@@ -195,8 +705,8 @@ func TestPartialDeleteMultiple(t *testing.T) {
 
 	toDel := []store.Item{s, s1, s2}
 	count, err := db.DeleteMultiple(toDel)
-	if err != store.ErrKeyNotFound {
-		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	if merr, ok := err.(store.MultiError); !ok || merr.Err(2) != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound for the third item, got: ", err)
 	}
 
 	if count != 2 {
@@ -314,6 +824,66 @@ func benchmarkReadMultiple(n int, b *testing.B) {
 
 func BenchmarkReadMultiple1k(b *testing.B) { benchmarkReadMultiple(1000, b) }
 
+func TestContext(t *testing.T) {
+	db := testContextStore(t)
+	ctx := context.Background()
+	s := &TestR{Field: "value"}
+	if err := db.WriteContext(ctx, s); err != nil {
+		t.Fatal("err", err)
+	}
+	got := &TestR{ID: s.Key()}
+	if err := db.ReadContext(ctx, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(s, got) {
+		t.Fatal("expected:", s, " got:", got)
+	}
+	if err := db.DeleteContext(ctx, got); err != nil {
+		t.Fatal("err", err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	db := testContextStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := db.WriteContext(ctx, &TestR{}); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	var items []TestR
+	if err := db.ListContext(ctx, &items); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if err := db.ReadMultipleContext(ctx, []TestR{{ID: "id"}}); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if err := db.WriteMultipleContext(ctx, []store.Item{&TestR{}}); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+
+	r := db.(*Redis)
+	if err := r.PatchContext(ctx, &TestR{ID: "id"}); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if err := r.UpdateFieldsContext(ctx, &TestR{ID: "id"}, map[string]interface{}{"FieldInt": 1}); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if _, err := r.IncrementContext(ctx, &TestR{ID: "id"}, "FieldInt", 1); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if _, err := r.IncrementFloatContext(ctx, &TestR{ID: "id"}, "FieldFloat", 1); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	var found []storetest.Indexed
+	if err := r.FindByContext(ctx, "Name", "alan", &found); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+	if err := r.FindRangeContext(ctx, "Age", 0, 1, &found); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got: ", err)
+	}
+}
+
 func testStoreB(b *testing.B) store.Store {
 	db, err := NewStore(testRedisURL, testNs)
 	if err != nil {
@@ -330,6 +900,19 @@ func testStore(t *testing.T) store.Store {
 	return db
 }
 
+func testContextStore(t *testing.T) store.ContextStore {
+	cfg, err := NewConfig(testRedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespace = testNs
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func flushRedisDB() {
 	cfg, err := NewConfig(testRedisURL)
 	if err != nil {
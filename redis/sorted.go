@@ -0,0 +1,79 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// ListSorted populates the slice dst with ids of the slice element type in
+// the order described by by, reading a range of the sorted set of the
+// numeric indexed field with ZRANGE or ZREVRANGE. Ordering by creation time
+// reads the sorted set of ids, the items written before the store maintained
+// it are added by Reindex. The ids of expired items are removed from the
+// sorted sets as they are read.
+func (s *Redis) ListSorted(dst interface{}, by store.Sort) error {
+	return s.ListSortedContext(context.Background(), dst, by)
+}
+
+// ListSortedContext is like ListSorted but stops reading ranges when ctx is
+// done.
+func (s *Redis) ListSortedContext(ctx context.Context, dst interface{}, by store.Sort) error {
+	sl, err := store.NewSlice(dst)
+	if err != nil {
+		return err
+	}
+	set := s.idsKey(sl.Type())
+	if by.Field != "" {
+		x, err := store.LookupIndex(sl.Type(), by.Field)
+		if err != nil {
+			return err
+		}
+		if !x.Numeric {
+			return store.ErrNotIndexed
+		}
+		set = s.indexKey(sl.Type(), x, nil)
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	cmd := "ZRANGE"
+	if by.Descending {
+		cmd = "ZREVRANGE"
+	}
+	start, stop := by.Offset, -1
+	if start < 0 {
+		start = 0
+	}
+	if by.Limit > 0 {
+		stop = start + by.Limit - 1
+	}
+	prefix := s.typeName(sl.Type()) + s.sep
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, err := driver.Strings(c.Do(cmd, set, start, stop))
+		if err != nil {
+			return err
+		}
+		n := len(keys)
+		if keys, err = s.live(c, prefix, set, keys); err != nil {
+			return err
+		}
+		// Read the range again when expired ids were removed from it, so
+		// that the range is filled by the ids that follow
+		if len(keys) == n || stop < 0 {
+			return sl.SetKeys(keys)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gosuri/go-store/store"
+)
+
+func TestTyped(t *testing.T) {
+	db := store.NewTyped[TestR](testStore(t))
+	ctx := context.Background()
+
+	s := &TestR{Field: "value", FieldInt: 1}
+	if err := db.Put(ctx, s); err != nil {
+		t.Fatal("err", err)
+	}
+	got, err := db.Get(ctx, s.Key())
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(*s, got) {
+		t.Fatal("expected:", s, " got:", got)
+	}
+
+	many, err := db.GetMany(ctx, []string{s.Key()})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []TestR{*s}; !reflect.DeepEqual(many, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, many)
+	}
+
+	if err := db.Delete(ctx, s.Key()); err != nil {
+		t.Fatal("err", err)
+	}
+	if _, err := db.Get(ctx, s.Key()); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrNotFound, got: ", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	driver "github.com/garyburd/redigo/redis"
+	"github.com/gosuri/go-store/store"
+)
+
+// UpdateFields writes the values of fields to the hash stored for the item
+// using HSET, leaving the other fields in place. Like Patch, it returns a
+// store.ErrKeyNotFound error when the key does not exist. It returns
+// ErrDocument for items stored as documents, as do the increment methods.
+func (s *Redis) UpdateFields(i store.Item, fields map[string]interface{}) error {
+	return s.UpdateFieldsContext(context.Background(), i, fields)
+}
+
+// UpdateFieldsContext is like UpdateFields but gives up acquiring a
+// connection when ctx is done.
+func (s *Redis) UpdateFieldsContext(ctx context.Context, i store.Item, fields map[string]interface{}) error {
+	ri := s.newItem(i)
+	if err := ri.validate(); err != nil {
+		return err
+	}
+	if ri.codec != nil {
+		return ErrDocument
+	}
+	ri.data = make(map[string][]byte, len(fields))
+	for name, value := range fields {
+		f, err := s.encoding().LookupField(ri.typ, name)
+		if err != nil {
+			return err
+		}
+		if ri.data[f.Name], err = f.Encode(value); err != nil {
+			return err
+		}
+	}
+	ri.merge = true
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return s.writeBatch(c, []*item{ri})
+}
+
+// Increment atomically adds delta to the integer field of the item using
+// HINCRBY and returns the new value. It returns an error, leaving the field
+// unchanged, when the new value overflows the type of the field.
+func (s *Redis) Increment(i store.Item, field string, delta int64) (int64, error) {
+	return s.IncrementContext(context.Background(), i, field, delta)
+}
+
+// IncrementContext is like Increment but gives up acquiring a connection
+// when ctx is done.
+func (s *Redis) IncrementContext(ctx context.Context, i store.Item, field string, delta int64) (int64, error) {
+	reply, err := s.increment(ctx, i, field, "HINCRBY", delta, isInt, func(f store.Field, cur []byte) (bool, error) {
+		var v int64
+		if cur != nil {
+			var err error
+			if v, err = strconv.ParseInt(string(cur), 10, 64); err != nil {
+				return false, err
+			}
+		}
+		sum := v + delta
+		return (sum > v) != (delta > 0) || f.OverflowInt(sum), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return driver.Int64(reply, nil)
+}
+
+// IncrementFloat atomically adds delta to the float field of the item using
+// HINCRBYFLOAT and returns the new value. Like Increment, it returns an error
+// when the new value overflows the type of the field.
+func (s *Redis) IncrementFloat(i store.Item, field string, delta float64) (float64, error) {
+	return s.IncrementFloatContext(context.Background(), i, field, delta)
+}
+
+// IncrementFloatContext is like IncrementFloat but gives up acquiring a
+// connection when ctx is done.
+func (s *Redis) IncrementFloatContext(ctx context.Context, i store.Item, field string, delta float64) (float64, error) {
+	reply, err := s.increment(ctx, i, field, "HINCRBYFLOAT", delta, isFloat, func(f store.Field, cur []byte) (bool, error) {
+		var v float64
+		if cur != nil {
+			var err error
+			if v, err = strconv.ParseFloat(string(cur), 64); err != nil {
+				return false, err
+			}
+		}
+		return f.OverflowFloat(v + delta), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return driver.Float64(reply, nil)
+}
+
+// increment is a helper function that increments the field using cmd, along
+// with the score of its index entry and the version of the item. The field
+// is left unchanged when overflows reports that adding delta to its current
+// value, nil when it has none, overflows its type.
+func (s *Redis) increment(ctx context.Context, i store.Item, field, cmd string, delta interface{}, kind func(reflect.Kind) bool, overflows func(f store.Field, cur []byte) (bool, error)) (interface{}, error) {
+	ri := s.newItem(i)
+	if err := ri.validate(); err != nil {
+		return nil, err
+	}
+	if ri.codec != nil {
+		return nil, ErrDocument
+	}
+	f, err := s.encoding().LookupField(ri.typ, field)
+	if err != nil {
+		return nil, err
+	}
+	if !kind(f.Kind()) {
+		return nil, fmt.Errorf("store: cannot increment %s (type: %s)", f.Name, f.Kind())
+	}
+	ri.merge = true
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := s.watch(c, []*item{ri}); err != nil {
+			return nil, err
+		}
+		if !ri.exists {
+			return nil, store.ErrKeyNotFound
+		}
+		// the field is watched, it can't change before EXEC unnoticed
+		cur, err := driver.Bytes(c.Do("HGET", ri.Key(), f.Name))
+		if err != nil && err != driver.ErrNil {
+			return nil, err
+		}
+		overflow, err := overflows(f, cur)
+		if err != nil {
+			return nil, err
+		}
+		if overflow {
+			return nil, fmt.Errorf("store: incrementing %s by %v overflows %s", f.Name, delta, f.Kind())
+		}
+		c.Send("MULTI")
+		c.Send(cmd, ri.Key(), f.Name, delta)
+		for _, x := range ri.indexes {
+			if x.Field == f.Name && x.Numeric {
+				c.Send("ZINCRBY", s.indexKey(ri.typ, x, nil), delta, ri.key)
+			}
+		}
+		if ri.versioner != nil {
+			c.Send("HINCRBY", ri.Key(), versionField, 1)
+		}
+		reply, err := exec(c)
+		if err == errAborted {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ri.versioner != nil {
+			version, err := driver.Int64(reply[len(reply)-1], nil)
+			if err != nil {
+				return nil, err
+			}
+			ri.versioner.SetVersion(version)
+		}
+		return reply[0], nil
+	}
+	return nil, errAborted
+}
+
+// isInt is a helper function that reports whether k is an integer kind
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// isFloat is a helper function that reports whether k is a float kind
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
@@ -0,0 +1,800 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownField means that the item type has no exported field by the name
+// provided
+var ErrUnknownField = errors.New("store: unknown field")
+
+// Marshaler is the interface implemented by items that convert themselves
+// to the flat field representation persisted by stores, instead of having
+// their fields converted by reflection.
+//
+// MarshalStore returns the fields of the item as a map of field names to
+// their encoded values. Indexed fields must be stored under the names
+// Marshal would use for them. Stores may keep the map, it must not be
+// modified after it is returned.
+type Marshaler interface {
+	MarshalStore() (map[string][]byte, error)
+}
+
+// Unmarshaler is the interface implemented by items that restore themselves
+// from the fields returned by their MarshalStore method.
+//
+// UnmarshalStore must copy data if it wishes to retain the values after
+// returning.
+type Unmarshaler interface {
+	UnmarshalStore(data map[string][]byte) error
+}
+
+// Codec is the interface that wraps the Marshal and Unmarshal methods used to
+// encode nested values, such as structs, slices and maps, into a single field.
+//
+// Unmarshal is given a pointer to the value to decode data into.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is a Codec that encodes values using the encoding/json package.
+var JSON Codec = jsonCodec{}
+
+// Gob is a Codec that encodes values using the encoding/gob package.
+var Gob Codec = gobCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Encoding converts items to and from the flat field representation
+// persisted by stores.
+//
+// Nested values, that is structs other than time.Time, slices other than
+// byte slices, arrays, maps and interfaces, are encoded into a single field
+// using Codec. When Flatten is set, nested structs and maps with string keys
+// are stored as one field for each of their values instead, named by joining
+// the names with dots, such as "Address.City" or "Meta.color".
+type Encoding struct {
+	// Codec encodes nested values, JSON is used when nil
+	Codec Codec
+	// Flatten stores nested structs and maps in dotted fields
+	Flatten bool
+}
+
+// DefaultEncoding is the Encoding used by Marshal, Unmarshal and
+// LookupField. It encodes nested values using JSON.
+var DefaultEncoding = &Encoding{}
+
+// Field describes an exported field of an item type, as it is stored by
+// Marshal.
+type Field struct {
+	// Name is the name the field is stored under
+	Name string
+	// Type is the type of the field
+	Type reflect.Type
+
+	enc *Encoding
+}
+
+// LookupField returns the field of the struct type t, or of the struct type
+// t points to, by its Go name or the name it is stored under. It returns
+// ErrUnknownField when t has no such exported field, or the field is skipped
+// by its tag.
+func LookupField(t reflect.Type, name string) (Field, error) {
+	return DefaultEncoding.LookupField(t, name)
+}
+
+// LookupField is like the LookupField function, the field returned encodes
+// values using e.
+func (e *Encoding) LookupField(t reflect.Type, name string) (Field, error) {
+	for _, f := range structFields(t) {
+		if f.name == name || f.goName == name {
+			return Field{Name: f.name, Type: f.typ, enc: e}, nil
+		}
+	}
+	return Field{}, ErrUnknownField
+}
+
+// Encode returns value encoded the same way Marshal encodes the field. It
+// returns an error when value can't be converted to the type of the field,
+// or the field is flattened into several fields.
+func (f Field) Encode(value interface{}) ([]byte, error) {
+	if f.enc.flattens(f.Type) {
+		return nil, fmt.Errorf("store: cannot encode flattened field %s", f.Name)
+	}
+	return f.enc.encodeAs(f.Type, f.Name, value)
+}
+
+// Flattened reports whether the field is stored as one field for each of
+// its values, under the dotted names described for Encoding.
+func (f Field) Flattened() bool {
+	return f.enc.flattens(f.Type)
+}
+
+// Kind returns the kind of the values of the field, the kind of the type
+// pointed to for pointer fields.
+func (f Field) Kind() reflect.Kind {
+	return f.value().Kind()
+}
+
+// OverflowInt reports whether n can't be represented by the values of the
+// integer field. Stores use it to check the results of Increment before
+// storing them.
+func (f Field) OverflowInt(n int64) bool {
+	v := f.value()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.OverflowInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return n < 0 || v.OverflowUint(uint64(n))
+	}
+	return true
+}
+
+// OverflowFloat is like OverflowInt for float fields.
+func (f Field) OverflowFloat(n float64) bool {
+	v := f.value()
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.OverflowFloat(n)
+	}
+	return true
+}
+
+// value is a helper function that returns a settable zero value of the type
+// of the values of the field
+func (f Field) value() reflect.Value {
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.New(t).Elem()
+}
+
+// Project returns the values of data stored for fields, the values of
+// flattened fields are those stored under their dotted names.
+func Project(data map[string][]byte, fields []Field) map[string][]byte {
+	projected := make(map[string][]byte, len(fields))
+	for _, f := range fields {
+		if !f.Flattened() {
+			if b, ok := data[f.Name]; ok {
+				projected[f.Name] = b
+			}
+			continue
+		}
+		for key, b := range data {
+			if strings.HasPrefix(key, f.Name+".") {
+				projected[key] = b
+			}
+		}
+	}
+	return projected
+}
+
+// Marshal returns the exported fields of the struct pointed to by i as a map
+// of field names to their encoded values, using DefaultEncoding. Stores use
+// it to convert items to the flat field representation persisted in the
+// underlying data store.
+//
+// Strings and byte slices are stored as is, integers and floats in their
+// decimal form and bools as "1" or "0". Times are stored in the RFC 3339
+// format with nanoseconds, durations as their number of nanoseconds. Values
+// implementing encoding.TextMarshaler are stored as their text. Pointers
+// are stored as the value they point to, nil pointers are not stored. Nested
+// values are encoded as described for Encoding. The fields of anonymous
+// struct fields are stored as if they were fields of the outer struct, like
+// the encoding/json package does. Unexported fields are ignored. It returns
+// an error for fields of any other kind.
+//
+// The name a field is stored under and how it is encoded can be customized
+// with the "store" struct field tag, following the conventions of the
+// encoding/json package:
+//
+//	// Stored under "name".
+//	Name string `store:"name"`
+//
+//	// Stored under "email", and not stored when empty.
+//	Email string `store:"email,omitempty"`
+//
+//	// Stored under the field name when empty, and not stored when empty.
+//	Nick string `store:",omitempty"`
+//
+//	// Never stored.
+//	Secret string `store:"-"`
+//
+// Fields skipped by their tag are left untouched by Unmarshal. When several
+// fields are stored under the same name, the least nested one is used, or
+// the first one when they are nested as deep.
+//
+// Items that implement Marshaler are converted by their MarshalStore method
+// instead.
+func Marshal(i Item) (map[string][]byte, error) {
+	return DefaultEncoding.Marshal(i)
+}
+
+// Marshal is like the Marshal function, using e to encode nested values.
+func (e *Encoding) Marshal(i Item) (map[string][]byte, error) {
+	if m, ok := i.(Marshaler); ok {
+		return m.MarshalStore()
+	}
+	data := make(map[string][]byte)
+	if err := e.marshal(reflect.ValueOf(i).Elem(), "", data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Unmarshal copies the values in data to the fields of the struct pointed to
+// by i, matching map keys to the names the fields are stored under, using
+// DefaultEncoding. It is the inverse of Marshal. Fields with no value in
+// data are set to their zero value, as Marshal doesn't store empty fields
+// tagged omitempty and nil pointers. Keys that do not match a stored field
+// are ignored. Items that implement Unmarshaler are restored by their
+// UnmarshalStore method instead.
+func Unmarshal(data map[string][]byte, i Item) error {
+	return DefaultEncoding.Unmarshal(data, i)
+}
+
+// Unmarshal is like the Unmarshal function, using e to decode nested values.
+func (e *Encoding) Unmarshal(data map[string][]byte, i Item) error {
+	if u, ok := i.(Unmarshaler); ok {
+		return u.UnmarshalStore(data)
+	}
+	return e.unmarshal(reflect.ValueOf(i).Elem(), "", data)
+}
+
+// UnmarshalFields is like Unmarshal but only copies the values of fields,
+// the other fields of the item are left untouched. The fields with no value
+// in data are set to their zero value. Stores use it to read only some of
+// the fields of items. Items that implement Unmarshaler are given the values
+// of data returned by Project.
+func UnmarshalFields(data map[string][]byte, i Item, fields []Field) error {
+	return DefaultEncoding.UnmarshalFields(data, i, fields)
+}
+
+// UnmarshalFields is like the UnmarshalFields function, using e to decode
+// nested values.
+func (e *Encoding) UnmarshalFields(data map[string][]byte, i Item, fields []Field) error {
+	if u, ok := i.(Unmarshaler); ok {
+		return u.UnmarshalStore(Project(data, fields))
+	}
+	value := reflect.ValueOf(i).Elem()
+	for _, f := range fields {
+		for _, sf := range structFields(value.Type()) {
+			if sf.name != f.Name {
+				continue
+			}
+			if err := e.unmarshalField(value, sf, sf.name, data); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// marshal is a helper function that encodes the stored fields of the struct
+// value into data, with their names prefixed by prefix
+func (e *Encoding) marshal(value reflect.Value, prefix string, data map[string][]byte) error {
+	for _, f := range structFields(value.Type()) {
+		field, ok := fieldByIndex(value, f.index, false)
+		// promoted through a nil pointer
+		if !ok {
+			continue
+		}
+		if f.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+		if err := e.marshalValue(field, prefix+f.name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalValue is a helper function that encodes v into data under name, or
+// its values under their dotted names when v is flattened
+func (e *Encoding) marshalValue(v reflect.Value, name string, data map[string][]byte) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if !e.flattens(v.Type()) {
+		b, err := e.encodeField(v)
+		if err != nil {
+			return fmt.Errorf("store: cannot convert %s (type: %s): %v", name, v.Kind(), err)
+		}
+		data[name] = b
+		return nil
+	}
+	v = reflect.Indirect(v)
+	if v.Kind() == reflect.Struct {
+		return e.marshal(v, name+".", data)
+	}
+	for _, k := range v.MapKeys() {
+		if err := e.marshalValue(v.MapIndex(k), name+"."+k.String(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshal is a helper function that decodes the values in data into the
+// stored fields of the struct value, with their names prefixed by prefix
+func (e *Encoding) unmarshal(value reflect.Value, prefix string, data map[string][]byte) error {
+	for _, f := range structFields(value.Type()) {
+		if err := e.unmarshalField(value, f, prefix+f.name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalField is a helper function that decodes the value in data stored
+// under name into the field f of the struct value, or sets the field to its
+// zero value when data has no value for it
+func (e *Encoding) unmarshalField(value reflect.Value, f structField, name string, data map[string][]byte) error {
+	var found bool
+	if e.flattens(f.typ) {
+		found = hasPrefix(data, name+".")
+	} else {
+		_, found = data[name]
+	}
+	if !found {
+		// fields promoted through a nil pointer are already empty
+		if field, ok := fieldByIndex(value, f.index, false); ok {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		return nil
+	}
+	field, _ := fieldByIndex(value, f.index, true)
+	return e.unmarshalValue(field, name, data)
+}
+
+// unmarshalValue is a helper function that decodes the value in data stored
+// under name into v, or its values stored under dotted names when v is
+// flattened. Flattened maps are replaced.
+func (e *Encoding) unmarshalValue(v reflect.Value, name string, data map[string][]byte) error {
+	if !e.flattens(v.Type()) {
+		if err := e.decodeField(v, data[name]); err != nil {
+			return fmt.Errorf("store: cannot convert %s (type: %s): %v", name, v.Kind(), err)
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		return e.unmarshal(v, name+".", data)
+	}
+
+	prefix := name + "."
+	elem := v.Type().Elem()
+	m := reflect.MakeMap(v.Type())
+	for key := range data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		k := key[len(prefix):]
+		// the values of flattened elements are stored under the
+		// element key followed by a dot
+		if e.flattens(elem) {
+			n := strings.Index(k, ".")
+			if n < 0 {
+				continue
+			}
+			k = k[:n]
+		}
+		kv := reflect.ValueOf(k).Convert(v.Type().Key())
+		if m.MapIndex(kv).IsValid() {
+			continue
+		}
+		ev := reflect.New(elem).Elem()
+		if err := e.unmarshalValue(ev, prefix+k, data); err != nil {
+			return err
+		}
+		m.SetMapIndex(kv, ev)
+	}
+	v.Set(m)
+	return nil
+}
+
+// flattens is a helper function that reports whether values of type t are
+// stored in dotted fields
+func (e *Encoding) flattens(t reflect.Type) bool {
+	if e == nil || !e.Flatten {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isText(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != timeType
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// codec is a helper function that returns the codec used for nested values
+func (e *Encoding) codec() Codec {
+	if e == nil || e.Codec == nil {
+		return JSON
+	}
+	return e.Codec
+}
+
+// hasPrefix is a helper function that reports whether any of the keys of
+// data start with prefix
+func hasPrefix(data map[string][]byte, prefix string) bool {
+	for key := range data {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex is a helper function that returns the nested field of v by
+// its index sequence. Nil pointers to embedded structs are allocated when
+// alloc is set, it reports false otherwise.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for n, i := range index {
+		if n > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// structField describes an exported field of a struct type, as it is
+// stored by Marshal
+type structField struct {
+	// index is the index sequence of the field in the struct, fields
+	// promoted from anonymous struct fields have more than one
+	index []int
+	// name is the name the field is stored under and goName the name of
+	// the field in the struct
+	name   string
+	goName string
+	typ    reflect.Type
+	// omitEmpty is set for fields that are not stored when empty, and
+	// indexed for fields that are indexed
+	omitEmpty bool
+	indexed   bool
+}
+
+// fieldCache caches the stored fields of struct types
+var fieldCache struct {
+	sync.RWMutex
+	m map[reflect.Type][]structField
+}
+
+// structFields is a helper function that returns the stored fields of the
+// struct type t, or of the struct type t points to
+func structFields(t reflect.Type) []structField {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fieldCache.RLock()
+	fields, ok := fieldCache.m[t]
+	fieldCache.RUnlock()
+	if ok {
+		return fields
+	}
+
+	all := typeFields(t, nil, map[reflect.Type]bool{t: true})
+	// less nested fields hide the fields of anonymous structs by the
+	// same name
+	sort.SliceStable(all, func(a, b int) bool {
+		return len(all[a].index) < len(all[b].index)
+	})
+	seen := make(map[string]bool)
+	for _, f := range all {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(a, b int) bool {
+		return lessIndex(fields[a].index, fields[b].index)
+	})
+
+	fieldCache.Lock()
+	if fieldCache.m == nil {
+		fieldCache.m = make(map[reflect.Type][]structField)
+	}
+	fieldCache.m[t] = fields
+	fieldCache.Unlock()
+	return fields
+}
+
+// typeFields is a helper function that returns the stored fields of the
+// struct type t, including the fields of its anonymous struct fields not
+// already visited, with their index sequence prefixed by index
+func typeFields(t reflect.Type, index []int, visited map[reflect.Type]bool) []structField {
+	var fields []structField
+	for n := 0; n < t.NumField(); n++ {
+		f := t.Field(n)
+		tag := f.Tag.Get("store")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		fi := append(append([]int(nil), index...), n)
+
+		// the fields of anonymous structs without a name are promoted,
+		// unless they can't be set through an unexported pointer
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				if visited[ft] || (len(f.PkgPath) != 0 && f.Type.Kind() == reflect.Ptr) {
+					continue
+				}
+				visited[ft] = true
+				fields = append(fields, typeFields(ft, fi, visited)...)
+				delete(visited, ft)
+				continue
+			}
+		}
+		// ignore unexported fields
+		if len(f.PkgPath) != 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		fields = append(fields, structField{
+			index:     fi,
+			name:      name,
+			goName:    f.Name,
+			typ:       f.Type,
+			omitEmpty: opts.Contains("omitempty"),
+			indexed:   opts.Contains("index"),
+		})
+	}
+	return fields
+}
+
+// lessIndex is a helper function that reports whether the index sequence a
+// comes before b in the order of the struct fields
+func lessIndex(a, b []int) bool {
+	for n := 0; n < len(a) && n < len(b); n++ {
+		if a[n] != b[n] {
+			return a[n] < b[n]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// timeType is the type of time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// textMarshalerType and textUnmarshalerType are the types of the
+// encoding.TextMarshaler and encoding.TextUnmarshaler interfaces
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isText is a helper function that reports whether values of type t, other
+// than times, are stored as their text
+func isText(t reflect.Type) bool {
+	if t == timeType {
+		return false
+	}
+	return t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// isEmptyValue is a helper function that reports whether v is the zero value
+// of its kind, an empty string, map or slice, or the zero time
+func isEmptyValue(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// encodeAs is a helper function that converts value to the type typ of the
+// field named name and encodes it. Values of pointer fields may be given as
+// the value they point to.
+func (e *Encoding) encodeAs(typ reflect.Type, name string, value interface{}) ([]byte, error) {
+	v := reflect.ValueOf(value)
+	if typ.Kind() == reflect.Ptr && v.IsValid() && v.Kind() != reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if !v.IsValid() || !sameClass(v.Kind(), typ.Kind()) || !v.Type().ConvertibleTo(typ) {
+		return nil, fmt.Errorf("store: cannot convert %v to %s (type: %s)", value, name, typ.Kind())
+	}
+	b, err := e.encodeField(v.Convert(typ))
+	if err != nil {
+		return nil, fmt.Errorf("store: cannot convert %s (type: %s): %v", name, typ.Kind(), err)
+	}
+	return b, nil
+}
+
+// encodeField is a helper function that formats the value of the field
+func (e *Encoding) encodeField(field reflect.Value) ([]byte, error) {
+	if field.Type() == timeType {
+		return field.Interface().(time.Time).AppendFormat(nil, time.RFC3339Nano), nil
+	}
+	if field.Kind() == reflect.Ptr && field.IsNil() {
+		return nil, fmt.Errorf("nil pointer")
+	}
+	if field.Type().Implements(textMarshalerType) {
+		return field.Interface().(encoding.TextMarshaler).MarshalText()
+	}
+	if field.CanAddr() && reflect.PtrTo(field.Type()).Implements(textMarshalerType) {
+		return field.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+	}
+	switch field.Kind() {
+	case reflect.Ptr:
+		return e.encodeField(field.Elem())
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return e.codec().Marshal(field.Interface())
+		}
+		// copied, the caller may modify the slice after it is stored
+		return append([]byte{}, field.Bytes()...), nil
+	case reflect.Struct, reflect.Array, reflect.Map, reflect.Interface:
+		return e.codec().Marshal(field.Interface())
+	case reflect.String:
+		return []byte(field.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, field.Float(), 'g', -1, field.Type().Bits()), nil
+	case reflect.Bool:
+		if field.Bool() {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	}
+	return nil, fmt.Errorf("unsupported type")
+}
+
+// decodeField is a helper function that parses b into the field
+func (e *Encoding) decodeField(field reflect.Value, b []byte) error {
+	if field.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, string(b))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+		v := reflect.New(field.Type())
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText(b); err != nil {
+			return err
+		}
+		field.Set(v.Elem())
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(field.Type().Elem())
+		if err := e.decodeField(v.Elem(), b); err != nil {
+			return err
+		}
+		field.Set(v)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return e.decodeNested(field, b)
+		}
+		// copied, the stored value may be shared with other readers
+		field.SetBytes(append([]byte(nil), b...))
+	case reflect.Struct, reflect.Array, reflect.Map, reflect.Interface:
+		return e.decodeNested(field, b)
+	case reflect.String:
+		field.SetString(string(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(b), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(b), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(b), field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(string(b))
+		if err != nil {
+			return err
+		}
+		field.SetBool(v)
+	default:
+		return fmt.Errorf("unsupported type")
+	}
+	return nil
+}
+
+// decodeNested is a helper function that decodes b into the nested value of
+// the field using the codec. The field is reset first, so decoded maps
+// replace the values of the field instead of being merged into them.
+func (e *Encoding) decodeNested(field reflect.Value, b []byte) error {
+	v := reflect.New(field.Type())
+	if err := e.codec().Unmarshal(b, v.Interface()); err != nil {
+		return err
+	}
+	field.Set(v.Elem())
+	return nil
+}
@@ -0,0 +1,522 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	ID    string
+	Int   int64
+	Uint  uint8
+	Float float64
+	Bool  bool
+
+	private string
+}
+
+func (t *testItem) Key() string     { return t.ID }
+func (t *testItem) SetKey(k string) { t.ID = k }
+
+type testUnsupported struct {
+	ID string
+	Ch chan int
+}
+
+func (t *testUnsupported) Key() string     { return t.ID }
+func (t *testUnsupported) SetKey(k string) { t.ID = k }
+
+type testTagged struct {
+	ID      string `store:"id"`
+	Name    string `store:"name,omitempty,index"`
+	Count   int    `store:",omitempty"`
+	Secret  string `store:"-"`
+	Dash    string `store:"-,"`
+	Renamed string `store:"id"`
+}
+
+func (t *testTagged) Key() string     { return t.ID }
+func (t *testTagged) SetKey(k string) { t.ID = k }
+
+type testTypes struct {
+	ID      string
+	At      time.Time
+	Timeout time.Duration
+	Token   []byte
+	Limit   *int
+	Name    *string
+}
+
+func (t *testTypes) Key() string     { return t.ID }
+func (t *testTypes) SetKey(k string) { t.ID = k }
+
+type testAddress struct {
+	City string
+	Zip  int
+}
+
+type testBase struct {
+	ID      string
+	Created int64
+}
+
+type testNested struct {
+	testBase
+	Created string
+	Home    testAddress
+	Work    *testAddress
+	Tags    []string
+	Meta    map[string]string
+}
+
+func (t *testNested) Key() string     { return t.ID }
+func (t *testNested) SetKey(k string) { t.ID = k }
+
+// testCents is stored as a decimal amount, such as "12.34"
+type testCents int64
+
+func (c testCents) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%02d", c/100, c%100)), nil
+}
+
+func (c *testCents) UnmarshalText(b []byte) error {
+	parts := strings.SplitN(string(b), ".", 2)
+	if len(parts) != 2 {
+		return errors.New("invalid amount")
+	}
+	units, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	cents, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	*c = testCents(units*100 + cents)
+	return nil
+}
+
+type testPriced struct {
+	ID    string
+	Price testCents `store:",index"`
+	Sale  *testCents
+}
+
+func (t *testPriced) Key() string     { return t.ID }
+func (t *testPriced) SetKey(k string) { t.ID = k }
+
+type testCustom struct {
+	ID    string
+	Color string
+}
+
+func (t *testCustom) Key() string     { return t.ID }
+func (t *testCustom) SetKey(k string) { t.ID = k }
+
+func (t *testCustom) MarshalStore() (map[string][]byte, error) {
+	return map[string][]byte{"c": []byte(t.Color)}, nil
+}
+
+func (t *testCustom) UnmarshalStore(data map[string][]byte) error {
+	t.Color = string(data["c"])
+	return nil
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := Marshal(&testItem{ID: "id", Int: -1, Uint: 2, Float: 1.5, Bool: true, private: "x"})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	exp := map[string][]byte{
+		"ID":    []byte("id"),
+		"Int":   []byte("-1"),
+		"Uint":  []byte("2"),
+		"Float": []byte("1.5"),
+		"Bool":  []byte("1"),
+	}
+	if !reflect.DeepEqual(data, exp) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", exp, data)
+	}
+
+	if _, err := Marshal(&testUnsupported{}); err == nil {
+		t.Fatal("expected error for unsupported field")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	exp := &testItem{ID: "id", Int: -1, Uint: 2, Float: 1.5, Bool: true}
+	data, err := Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	data["Unknown"] = []byte("ignored")
+
+	got := &testItem{}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatal("expected:", exp, " got:", got)
+	}
+
+	if err := Unmarshal(map[string][]byte{"Uint": []byte("256")}, got); err == nil {
+		t.Fatal("expected error for overflowing value")
+	}
+
+	// only the fields given are unmarshalled, fields with no value are
+	// reset
+	got = &testItem{ID: "id", Int: -1, Uint: 2}
+	f, err := LookupField(reflect.TypeOf(got), "Int")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if err := UnmarshalFields(map[string][]byte{"ID": []byte("x")}, got, []Field{f}); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&testItem{ID: "id", Uint: 2}); !reflect.DeepEqual(got, exp) {
+		t.Fatal("expected:", exp, " got:", got)
+	}
+	// all fields are unmarshalled, as omitted fields are not stored
+	if err := Unmarshal(map[string][]byte{"ID": []byte("x")}, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&testItem{ID: "x"}); !reflect.DeepEqual(got, exp) {
+		t.Fatal("expected:", exp, " got:", got)
+	}
+}
+
+func TestMarshalTags(t *testing.T) {
+	data, err := Marshal(&testTagged{ID: "id", Secret: "secret", Dash: "dash", Renamed: "renamed"})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	exp := map[string][]byte{
+		"id": []byte("id"),
+		"-":  []byte("dash"),
+	}
+	if !reflect.DeepEqual(data, exp) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", exp, data)
+	}
+
+	data["name"] = []byte("name")
+	data["Secret"] = []byte("ignored")
+	got := &testTagged{Secret: "kept"}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	want := &testTagged{ID: "id", Name: "name", Secret: "kept", Dash: "dash"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("expected:", want, " got:", got)
+	}
+}
+
+func TestLookupField(t *testing.T) {
+	typ := reflect.TypeOf(&testTagged{})
+	for _, name := range []string{"Name", "name"} {
+		f, err := LookupField(typ, name)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		if f.Name != "name" {
+			t.Fatal("expected name, got:", f.Name)
+		}
+	}
+	for _, name := range []string{"Secret", "Unknown"} {
+		if _, err := LookupField(typ, name); err != ErrUnknownField {
+			t.Fatal("expected ErrUnknownField, got:", err)
+		}
+	}
+	x, err := LookupIndex(typ, "Name")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if x.Field != "name" {
+		t.Fatal("expected name, got:", x.Field)
+	}
+}
+
+func TestFieldOverflow(t *testing.T) {
+	tests := []struct {
+		typ   reflect.Type
+		field string
+		kind  reflect.Kind
+		n     int64
+		exp   bool
+	}{
+		{reflect.TypeOf(&testItem{}), "Uint", reflect.Uint8, 255, false},
+		{reflect.TypeOf(&testItem{}), "Uint", reflect.Uint8, 256, true},
+		{reflect.TypeOf(&testItem{}), "Uint", reflect.Uint8, -1, true},
+		{reflect.TypeOf(&testItem{}), "Int", reflect.Int64, -1 << 63, false},
+		{reflect.TypeOf(&testTypes{}), "Limit", reflect.Int, 1, false},
+		{reflect.TypeOf(&testItem{}), "ID", reflect.String, 1, true},
+	}
+	for _, tt := range tests {
+		f, err := LookupField(tt.typ, tt.field)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		if k := f.Kind(); k != tt.kind {
+			t.Fatalf("%s: expected %s, got: %s", tt.field, tt.kind, k)
+		}
+		if got := f.OverflowInt(tt.n); got != tt.exp {
+			t.Fatalf("%s: %d: expected %v, got: %v", tt.field, tt.n, tt.exp, got)
+		}
+	}
+
+	f, err := LookupField(reflect.TypeOf(&testItem{}), "Float")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if f.OverflowFloat(math.MaxFloat64) {
+		t.Fatal("expected MaxFloat64 to fit a float64")
+	}
+	if !f.OverflowInt(1) {
+		t.Fatal("expected float fields to overflow OverflowInt")
+	}
+}
+
+func TestMarshalTypes(t *testing.T) {
+	limit := 10
+	at := time.Date(2015, 10, 18, 9, 30, 0, 500, time.UTC)
+	exp := &testTypes{ID: "id", At: at, Timeout: 2 * time.Second, Token: []byte{0, 1, 2}, Limit: &limit}
+	data, err := Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	want := map[string][]byte{
+		"ID":      []byte("id"),
+		"At":      []byte("2015-10-18T09:30:00.0000005Z"),
+		"Timeout": []byte("2000000000"),
+		"Token":   {0, 1, 2},
+		"Limit":   []byte("10"),
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", want, data)
+	}
+
+	// the stored token is not shared with the item
+	exp.Token[0] = 9
+	got := &testTypes{}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	exp.Token[0] = 0
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	if err := Unmarshal(map[string][]byte{"At": []byte("yesterday")}, got); err == nil {
+		t.Fatal("expected error for invalid time")
+	}
+}
+
+func TestMarshalNested(t *testing.T) {
+	exp := &testNested{
+		testBase: testBase{ID: "id"},
+		Created:  "today",
+		Home:     testAddress{City: "Paris", Zip: 75001},
+		Tags:     []string{"a", "b"},
+		Meta:     map[string]string{"color": "red"},
+	}
+	data, err := Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	want := map[string][]byte{
+		"ID":      []byte("id"),
+		"Created": []byte("today"),
+		"Home":    []byte(`{"City":"Paris","Zip":75001}`),
+		"Tags":    []byte(`["a","b"]`),
+		"Meta":    []byte(`{"color":"red"}`),
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", want, data)
+	}
+
+	got := &testNested{Meta: map[string]string{"stale": "value"}}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+}
+
+func TestEncodingGob(t *testing.T) {
+	enc := &Encoding{Codec: Gob}
+	exp := &testNested{
+		testBase: testBase{ID: "id"},
+		Work:     &testAddress{City: "Berlin"},
+		Tags:     []string{"a"},
+		Meta:     map[string]string{"color": "red"},
+	}
+	data, err := enc.Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	got := &testNested{}
+	if err := enc.Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+}
+
+func TestEncodingFlatten(t *testing.T) {
+	enc := &Encoding{Flatten: true}
+	exp := &testNested{
+		testBase: testBase{ID: "id"},
+		Home:     testAddress{City: "Paris", Zip: 75001},
+		Work:     &testAddress{City: "Berlin"},
+		Tags:     []string{"a"},
+		Meta:     map[string]string{"color": "red", "size": "xl"},
+	}
+	data, err := enc.Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	want := map[string][]byte{
+		"ID":         []byte("id"),
+		"Created":    []byte(""),
+		"Home.City":  []byte("Paris"),
+		"Home.Zip":   []byte("75001"),
+		"Work.City":  []byte("Berlin"),
+		"Work.Zip":   []byte("0"),
+		"Tags":       []byte(`["a"]`),
+		"Meta.color": []byte("red"),
+		"Meta.size":  []byte("xl"),
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", want, data)
+	}
+
+	got := &testNested{}
+	if err := enc.Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	f, err := enc.LookupField(reflect.TypeOf(got), "Home")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if _, err := f.Encode(testAddress{}); err == nil {
+		t.Fatal("expected error encoding a flattened field")
+	}
+
+	tags, err := enc.LookupField(reflect.TypeOf(got), "Tags")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if !f.Flattened() || tags.Flattened() {
+		t.Fatal("expected only Home to be flattened")
+	}
+	want = map[string][]byte{
+		"Home.City": []byte("Paris"),
+		"Home.Zip":  []byte("75001"),
+		"Tags":      []byte(`["a"]`),
+	}
+	if projected := Project(data, []Field{f, tags}); !reflect.DeepEqual(projected, want) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", want, projected)
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	sale := testCents(999)
+	exp := &testPriced{ID: "id", Price: 1234, Sale: &sale}
+	data, err := Marshal(exp)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	want := map[string][]byte{
+		"ID":    []byte("id"),
+		"Price": []byte("12.34"),
+		"Sale":  []byte("9.99"),
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", want, data)
+	}
+
+	got := &testPriced{}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	if x, _ := LookupIndex(reflect.TypeOf(got), "Price"); x.Numeric {
+		t.Fatal("expected text fields not to be numeric")
+	}
+	if err := Unmarshal(map[string][]byte{"Price": []byte("12")}, got); err == nil {
+		t.Fatal("expected error for invalid text")
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	data, err := Marshal(&testCustom{ID: "id", Color: "red"})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := map[string][]byte{"c": []byte("red")}; !reflect.DeepEqual(data, exp) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", exp, data)
+	}
+	got := &testCustom{}
+	if err := Unmarshal(data, got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.Color != "red" {
+		t.Fatal("expected red, got:", got.Color)
+	}
+}
+
+func TestIndexTime(t *testing.T) {
+	type event struct {
+		At   time.Time  `store:",index"`
+		Done *time.Time `store:",index"`
+	}
+	at := time.Date(2015, 10, 18, 9, 30, 0, 500, time.UTC)
+	for _, name := range []string{"At", "Done"} {
+		x, err := LookupIndex(reflect.TypeOf(event{}), name)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		if !x.Numeric {
+			t.Fatalf("expected %s to be numeric", name)
+		}
+		b, err := x.Encode(at)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		score, err := x.Score(b)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		if exp := float64(at.UnixNano() / int64(time.Microsecond)); score != exp {
+			t.Fatalf("expected %v, got: %v", exp, score)
+		}
+	}
+	// times a microsecond apart score apart
+	x, _ := LookupIndex(reflect.TypeOf(event{}), "At")
+	b, _ := x.Encode(at.Add(time.Microsecond))
+	if score, err := x.Score(b); err != nil || score != float64(at.UnixNano()/int64(time.Microsecond)+1) {
+		t.Fatal("expected the next microsecond to score one more, got: ", score, err)
+	}
+	b, _ = x.Encode(time.Time{})
+	if score, err := x.Score(b); err != nil || score >= 0 {
+		t.Fatal("expected the zero time to score below the Unix epoch, got: ", score, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrEmptyCollection means that the collection name provided is empty, or
+// that the type of the items has no collection name
+var ErrEmptyCollection = errors.New("store: collection name is empty")
+
+// Collection is the interface that wraps the CollectionName method.
+//
+// CollectionName returns the name of the collection items of the type are
+// stored in. Stores group items by collection, they use the name of the Go
+// type of the item when it doesn't implement Collection and isn't registered
+// using Register. It is called on the zero value of the type.
+type Collection interface {
+	CollectionName() string
+}
+
+// registry holds the collection names of the types registered using
+// Register, and the types by name
+var registry struct {
+	sync.RWMutex
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+// Register stores the items of the type of i in the collection name, taking
+// precedence over the CollectionName method of the type. It returns an error
+// when another type is registered under name, or the type is registered
+// under another name. Registering the type again under the same name has no
+// effect.
+//
+// Types should be registered before any of their items are stored, usually
+// in an init function:
+//
+//	func init() {
+//		store.Register(&billing.Account{}, "billing.Account")
+//		store.Register(&auth.Account{}, "auth.Account")
+//	}
+func Register(i Item, name string) error {
+	if len(name) == 0 {
+		return ErrEmptyCollection
+	}
+	t := reflect.TypeOf(i).Elem()
+
+	registry.Lock()
+	defer registry.Unlock()
+	if other, ok := registry.types[name]; ok && other != t {
+		return fmt.Errorf("store: collection %s is registered for %s", name, other)
+	}
+	if other, ok := registry.names[t]; ok && other != name {
+		return fmt.Errorf("store: %s is registered as collection %s", t, other)
+	}
+	if registry.names == nil {
+		registry.names = make(map[reflect.Type]string)
+		registry.types = make(map[string]reflect.Type)
+	}
+	registry.names[t] = name
+	registry.types[name] = t
+	return nil
+}
+
+// CollectionName returns the name of the collection the items of the struct
+// type t, or of the struct type t points to, are stored in. It is the name
+// the type is registered under, the name returned by its CollectionName
+// method, or the name of the type.
+//
+// The name of an unnamed type, such as struct{ Account }, is empty, and
+// stores return ErrEmptyCollection for its items, see ValidateCollection.
+// The name of an instantiated generic type holds the import paths of its
+// type arguments, such as "Box[github.com/acme/billing.Account]", which
+// changes when the packages move. Such types should be registered.
+func CollectionName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	registry.RLock()
+	name, ok := registry.names[t]
+	registry.RUnlock()
+	if ok {
+		return name
+	}
+	if c, ok := reflect.New(t).Interface().(Collection); ok {
+		return c.CollectionName()
+	}
+	return t.Name()
+}
+
+// ValidateCollection returns ErrEmptyCollection when the collection name of
+// the items of the struct type t, or of the struct type t points to, is
+// empty. Stores validate the types of items before reading, writing or
+// deleting them, so that items of unnamed types don't share a collection.
+func ValidateCollection(t reflect.Type) error {
+	if len(CollectionName(t)) == 0 {
+		return ErrEmptyCollection
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testCollection struct {
+	ID string
+}
+
+func (t *testCollection) Key() string            { return t.ID }
+func (t *testCollection) SetKey(k string)        { t.ID = k }
+func (t *testCollection) CollectionName() string { return "collection" }
+
+type testRegistered struct {
+	ID string
+}
+
+func (t *testRegistered) Key() string     { return t.ID }
+func (t *testRegistered) SetKey(k string) { t.ID = k }
+
+func TestCollectionName(t *testing.T) {
+	if name := CollectionName(reflect.TypeOf(&testItem{})); name != "testItem" {
+		t.Fatal("expected testItem, got:", name)
+	}
+	if name := CollectionName(reflect.TypeOf(testCollection{})); name != "collection" {
+		t.Fatal("expected collection, got:", name)
+	}
+
+	if err := Register(&testCollection{}, "registered.collection"); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := Register(&testCollection{}, "registered.collection"); err != nil {
+		t.Fatal("expected registering again to succeed, got:", err)
+	}
+	if name := CollectionName(reflect.TypeOf(testCollection{})); name != "registered.collection" {
+		t.Fatal("expected registered.collection, got:", name)
+	}
+	if err := Register(&testRegistered{}, "registered.collection"); err == nil {
+		t.Fatal("expected error registering two types under one name")
+	}
+	if err := Register(&testCollection{}, "other"); err == nil {
+		t.Fatal("expected error registering a type under two names")
+	}
+	if err := Register(&testRegistered{}, ""); err != ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got:", err)
+	}
+
+	unnamed := reflect.TypeOf(&struct{ testItem }{})
+	if name := CollectionName(unnamed); name != "" {
+		t.Fatal("expected no name, got:", name)
+	}
+	if err := ValidateCollection(unnamed); err != ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got:", err)
+	}
+	if _, err := NewSlice([]struct{ testItem }{}); err != ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got:", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MarshalDocument returns the item i encoded as a single document using the
+// codec c, for stores that persist items as documents instead of fields.
+//
+// The document holds the fields Marshal would store, under the same names,
+// but their values are encoded by the codec as they are instead of being
+// converted to text. With JSON, an item with a Name field tagged "name" and
+// an Age field is stored as {"name":"alan","Age":41}. Fields that are
+// empty and tagged omitempty, nil pointers and fields skipped by their tag
+// are not stored. The names of the fields of documents encoded with codecs
+// that use Go field names, such as Gob, are escaped when they are not
+// exported Go identifiers.
+//
+// Items that implement Marshaler are stored as a map of the field names
+// returned by MarshalStore to their values as strings.
+func MarshalDocument(c Codec, i Item) ([]byte, error) {
+	if m, ok := i.(Marshaler); ok {
+		data, err := m.MarshalStore()
+		if err != nil {
+			return nil, err
+		}
+		doc := make(map[string]string, len(data))
+		for name, b := range data {
+			doc[name] = string(b)
+		}
+		return c.Marshal(doc)
+	}
+
+	value := reflect.ValueOf(i).Elem()
+	dt, err := documentType(value.Type())
+	if err != nil {
+		return nil, err
+	}
+	doc := reflect.New(dt.typ).Elem()
+	for n, f := range dt.fields {
+		field, ok := fieldByIndex(value, f.index, false)
+		// promoted through a nil pointer
+		if !ok || f.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+		if field.Kind() != reflect.Ptr {
+			field = field.Addr()
+		}
+		doc.Field(n).Set(field)
+	}
+	return c.Marshal(doc.Interface())
+}
+
+// UnmarshalDocument copies the fields of the document doc encoded by
+// MarshalDocument using the codec c to the item i. Only the values of fields
+// are copied when it is not empty, the other fields of the item are left
+// untouched. Fields with no value in doc are set to their zero value, like
+// Unmarshal does.
+func UnmarshalDocument(c Codec, doc []byte, i Item, fields []Field) error {
+	if u, ok := i.(Unmarshaler); ok {
+		var values map[string]string
+		if err := c.Unmarshal(doc, &values); err != nil {
+			return err
+		}
+		data := make(map[string][]byte, len(values))
+		for name, s := range values {
+			data[name] = []byte(s)
+		}
+		if len(fields) > 0 {
+			data = Project(data, fields)
+		}
+		return u.UnmarshalStore(data)
+	}
+
+	value := reflect.ValueOf(i).Elem()
+	dt, err := documentType(value.Type())
+	if err != nil {
+		return err
+	}
+	decoded := reflect.New(dt.typ)
+	if err := c.Unmarshal(doc, decoded.Interface()); err != nil {
+		return err
+	}
+	for n, f := range dt.fields {
+		if len(fields) > 0 && !hasField(fields, f.name) {
+			continue
+		}
+		v := decoded.Elem().Field(n)
+		if v.IsNil() {
+			if field, ok := fieldByIndex(value, f.index, false); ok {
+				field.Set(reflect.Zero(field.Type()))
+			}
+			continue
+		}
+		field, _ := fieldByIndex(value, f.index, true)
+		if field.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		field.Set(v)
+	}
+	return nil
+}
+
+// hasField is a helper function that reports whether fields has a field
+// stored under name
+func hasField(fields []Field, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// docType describes the struct type documents of an item type are decoded
+// into, with a pointer field for each of the stored fields of the item type,
+// nil when the field is not stored
+type docType struct {
+	typ    reflect.Type
+	fields []structField
+}
+
+// docCache caches the document types of struct types
+var docCache struct {
+	sync.RWMutex
+	m map[reflect.Type]docType
+}
+
+// documentType is a helper function that returns the document type of the
+// struct type t
+func documentType(t reflect.Type) (docType, error) {
+	docCache.RLock()
+	dt, ok := docCache.m[t]
+	docCache.RUnlock()
+	if ok {
+		return dt, nil
+	}
+
+	dt.fields = structFields(t)
+	var sfs []reflect.StructField
+	names := make(map[string]string)
+	for _, f := range dt.fields {
+		name := documentFieldName(f.name)
+		if other, ok := names[name]; ok {
+			return docType{}, fmt.Errorf("store: cannot encode %s as a document, fields %s and %s have the same name", t, other, f.name)
+		}
+		names[name] = f.name
+		typ := f.typ
+		if typ.Kind() != reflect.Ptr {
+			typ = reflect.PtrTo(typ)
+		}
+		sfs = append(sfs, reflect.StructField{
+			Name: name,
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q`, f.name+",omitempty")),
+		})
+	}
+	dt.typ = reflect.StructOf(sfs)
+
+	docCache.Lock()
+	if docCache.m == nil {
+		docCache.m = make(map[reflect.Type]docType)
+	}
+	docCache.m[t] = dt
+	docCache.Unlock()
+	return dt, nil
+}
+
+// documentFieldName is a helper function that returns the name of the Go
+// field of document types for the field stored under name, name itself when
+// it is an exported identifier or X followed by its hex encoding otherwise
+func documentFieldName(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	exported := unicode.IsUpper(r)
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			exported = false
+		}
+	}
+	if exported {
+		return name
+	}
+	return "X" + hex.EncodeToString([]byte(name))
+}
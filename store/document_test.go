@@ -0,0 +1,83 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalDocument(t *testing.T) {
+	doc, err := MarshalDocument(JSON, &testTagged{ID: "id", Count: 2, Secret: "secret", Dash: "dash"})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := `{"id":"id","Count":2,"-":"dash"}`; string(doc) != exp {
+		t.Fatalf("Mismatch\nexp: %s \ngot: %s", exp, doc)
+	}
+
+	got := &testTagged{Name: "stale", Secret: "kept"}
+	if err := UnmarshalDocument(JSON, doc, got, nil); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&testTagged{ID: "id", Count: 2, Secret: "kept", Dash: "dash"}); !reflect.DeepEqual(got, exp) {
+		t.Fatal("expected:", exp, " got:", got)
+	}
+
+	// only the fields given are unmarshalled
+	f, err := LookupField(reflect.TypeOf(got), "Name")
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	got = &testTagged{Name: "stale", Count: 1}
+	if err := UnmarshalDocument(JSON, doc, got, []Field{f}); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&testTagged{Count: 1}); !reflect.DeepEqual(got, exp) {
+		t.Fatal("expected:", exp, " got:", got)
+	}
+}
+
+func TestMarshalDocumentTypes(t *testing.T) {
+	limit := 10
+	exp := &testTypes{
+		ID:      "id",
+		At:      time.Date(2015, 10, 18, 9, 30, 0, 500, time.UTC),
+		Timeout: 2 * time.Second,
+		Token:   []byte{0, 1, 2},
+		Limit:   &limit,
+	}
+	for _, codec := range []Codec{JSON, Gob} {
+		doc, err := MarshalDocument(codec, exp)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		got := &testTypes{}
+		if err := UnmarshalDocument(codec, doc, got, nil); err != nil {
+			t.Fatal("err", err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+		}
+	}
+}
+
+func TestMarshalDocumentMarshaler(t *testing.T) {
+	doc, err := MarshalDocument(JSON, &testCustom{ID: "id", Color: "red"})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := `{"c":"red"}`; string(doc) != exp {
+		t.Fatalf("Mismatch\nexp: %s \ngot: %s", exp, doc)
+	}
+	got := &testCustom{}
+	if err := UnmarshalDocument(JSON, doc, got, nil); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.Color != "red" {
+		t.Fatal("expected red, got:", got.Color)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"fmt"
+)
+
+// ItemError is the error of an item of ReadMultiple, WriteMultiple or
+// DeleteMultiple, such as ErrKeyNotFound, ErrEmptyKey or a conversion error.
+type ItemError struct {
+	// Index is the index of the item in the items passed, and Key its key
+	Index int
+	Key   string
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d (key %q): %v", e.Index, e.Key, e.Err)
+}
+
+// MultiError is returned by ReadMultiple, WriteMultiple and DeleteMultiple
+// when some of the items fail. It holds the error of each failing item, in
+// the order of the items. Errors that don't belong to an item, such as
+// connection errors, are returned as they are.
+//
+// The below example illustrates usage:
+//
+//	if merr, ok := err.(store.MultiError); ok {
+//		for _, e := range merr {
+//			if e.Err == store.ErrKeyNotFound {
+//				log.Println("missing:", e.Key)
+//			}
+//		}
+//	}
+type MultiError []ItemError
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "store: no errors"
+	case 1:
+		return m[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d other errors)", m[0], len(m)-1)
+}
+
+// Err returns the error of the item at index, or nil when it didn't fail.
+func (m MultiError) Err(index int) error {
+	for _, e := range m {
+		if e.Index == index {
+			return e.Err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"testing"
+)
+
+func TestMultiError(t *testing.T) {
+	merr := MultiError{{Index: 1, Key: "a", Err: ErrKeyNotFound}}
+	if exp := `item 1 (key "a"): store: key not found`; merr.Error() != exp {
+		t.Fatalf("expected %q, got: %q", exp, merr.Error())
+	}
+	merr = append(merr, ItemError{Index: 3, Err: ErrEmptyKey})
+	if exp := `item 1 (key "a"): store: key not found (and 1 other errors)`; merr.Error() != exp {
+		t.Fatalf("expected %q, got: %q", exp, merr.Error())
+	}
+	if err := merr.Err(3); err != ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+	if err := merr.Err(0); err != nil {
+		t.Fatal("expected no error, got: ", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrNotIndexed means that the field used to find items is not indexed
+var ErrNotIndexed = errors.New("store: field is not indexed")
+
+// Finder is the interface that wraps the FindBy and FindRange methods.
+//
+// FindBy populates the slice dst with the items of the slice element type
+// whose indexed field equals value. The value must be convertible to the
+// type of the field.
+//
+// FindRange populates the slice dst with the items whose numeric indexed
+// field is between min and max inclusive.
+//
+// Both return ErrNotIndexed when the field is not indexed, or for
+// FindRange, not numeric.
+type Finder interface {
+	FindBy(field string, value interface{}, dst interface{}) error
+	FindRange(field string, min, max float64, dst interface{}) error
+}
+
+// ContextFinder is the interface that wraps the FindByContext and
+// FindRangeContext methods, the context-aware variants of the Finder
+// methods.
+type ContextFinder interface {
+	FindByContext(ctx context.Context, field string, value interface{}, dst interface{}) error
+	FindRangeContext(ctx context.Context, field string, min, max float64, dst interface{}) error
+}
+
+// Index describes an indexed field of an item type. Fields are indexed by
+// adding the index option to the store struct field tag:
+//
+//	type Hacker struct {
+//		Id        string
+//		Name      string `store:"name,index"`
+//		Birthyear int    `store:",index"`
+//	}
+type Index struct {
+	// Field is the name the indexed field is stored under
+	Field string
+	// Numeric reports whether the field is an integer, a float or a
+	// time.Time, or a pointer to one, which are ordered by value and support
+	// range queries. Times are scored by their Unix time in microseconds,
+	// which float64 represents exactly for years 1685 to 2255, unlike
+	// nanoseconds.
+	// Other fields stored as text by encoding.TextMarshaler are not numeric.
+	Numeric bool
+
+	goName string
+	typ    reflect.Type
+}
+
+// Indexes returns the indexed fields of the struct type t, or of the struct
+// type t points to.
+func Indexes(t reflect.Type) []Index {
+	var indexes []Index
+	for _, f := range structFields(t) {
+		if !f.indexed {
+			continue
+		}
+		t := f.typ
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		indexes = append(indexes, Index{
+			Field:   f.name,
+			Numeric: t == timeType || isNumeric(t.Kind()) && !isText(t),
+			goName:  f.goName,
+			typ:     f.typ,
+		})
+	}
+	return indexes
+}
+
+// LookupIndex returns the index of the field of the struct type t, or of the
+// struct type t points to, by its Go name or the name it is stored under. It
+// returns ErrNotIndexed when the field is not indexed.
+func LookupIndex(t reflect.Type, field string) (Index, error) {
+	for _, x := range Indexes(t) {
+		if x.Field == field || x.goName == field {
+			return x, nil
+		}
+	}
+	return Index{}, ErrNotIndexed
+}
+
+// MarshalIndexes returns the indexed fields of the struct pointed to by i as
+// a map of field names to their encoded values, as Marshal returns them.
+// Stores that don't persist items as returned by Marshal use it to maintain
+// their indexes.
+func MarshalIndexes(i Item) (map[string][]byte, error) {
+	return DefaultEncoding.MarshalIndexes(i)
+}
+
+// MarshalIndexes is like the MarshalIndexes function, using e to encode
+// nested values.
+func (e *Encoding) MarshalIndexes(i Item) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	if _, ok := i.(Marshaler); ok {
+		all, err := e.Marshal(i)
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range Indexes(reflect.TypeOf(i)) {
+			if b, ok := all[x.Field]; ok {
+				data[x.Field] = b
+			}
+		}
+		return data, nil
+	}
+	value := reflect.ValueOf(i).Elem()
+	for _, f := range structFields(value.Type()) {
+		if !f.indexed {
+			continue
+		}
+		field, ok := fieldByIndex(value, f.index, false)
+		if !ok || f.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+		if err := e.marshalValue(field, f.name, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Encode returns value encoded the same way Marshal encodes the indexed
+// field. It returns an error when value can't be converted to the type of
+// the field.
+func (x Index) Encode(value interface{}) ([]byte, error) {
+	return DefaultEncoding.encodeAs(x.typ, x.Field, value)
+}
+
+// Score returns the encoded value b of a numeric indexed field as a float,
+// for use in ordered indexes.
+func (x Index) Score(b []byte) (float64, error) {
+	if x.typ == timeType || x.typ == reflect.PtrTo(timeType) {
+		t, err := time.Parse(time.RFC3339Nano, string(b))
+		if err != nil {
+			return 0, err
+		}
+		// UnixNano is undefined for times outside of years 1678 to 2262,
+		// such as the zero time
+		return float64(t.Unix())*1e6 + float64(t.Nanosecond()/1000), nil
+	}
+	return strconv.ParseFloat(string(b), 64)
+}
+
+// isNumeric is a helper function that reports whether values of kind k are
+// encoded as numbers
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// sameClass is a helper function that reports whether values of kind a can
+// be meaningfully converted to kind b, such as an int to a float but not an
+// int to a string
+func sameClass(a, b reflect.Kind) bool {
+	if isNumeric(a) || isNumeric(b) {
+		return isNumeric(a) && isNumeric(b)
+	}
+	return a == b
+}
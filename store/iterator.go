@@ -0,0 +1,156 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// ErrInvalidCursor means that the cursor passed to ListPage was not
+// returned by the store
+var ErrInvalidCursor = errors.New("store: cursor is invalid")
+
+// Pager is the interface that wraps the ListPage method.
+//
+// ListPage populates the slice dst with ids of the slice element type, like
+// List, starting at cursor. The cursor is empty for the first page, and the
+// next cursor returned is empty after the last page. Cursors are opaque, they
+// are only valid for the store that returned them. Stores return up to limit
+// ids, or as many as they see fit when limit is zero or less. Stores that
+// scan their keyspace, like package redis, treat limit as a hint and may
+// return more or fewer ids than limit; a page may be empty before the last.
+type Pager interface {
+	ListPage(dst interface{}, cursor string, limit int) (next string, err error)
+}
+
+// ContextPager is the interface that wraps the ListPageContext method.
+type ContextPager interface {
+	ListPageContext(ctx context.Context, dst interface{}, cursor string, limit int) (next string, err error)
+}
+
+// Iterator iterates over the ids of a collection without loading them all
+// at once.
+//
+// Next advances the iterator to the next item, it returns false when there
+// are no more items or an error occurred. Item returns the current item,
+// with only its key set as with List. Err returns the error that stopped the
+// iteration, if any. Close stops the iteration, Next returns false after.
+//
+// Cursor returns the cursor of the page after the current one, which
+// IterateFrom resumes the iteration from. The ids of the current page that
+// were not iterated yet are not part of the pages that follow, so
+// iterations are resumed without repeating or skipping ids when they stop
+// after the last id of a page, when Cursor changes after Next. It returns
+// the cursor the iteration started from before the first page is read, and
+// is empty after the last page, or for Listers that don't implement Pager.
+//
+// The below example illustrates usage:
+//
+//	it := store.Iterate(db, &Hacker{}, 100)
+//	defer it.Close()
+//	for it.Next() {
+//		h := it.Item().(*Hacker)
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator interface {
+	Next() bool
+	Item() Item
+	Err() error
+	Close() error
+	Cursor() string
+}
+
+// Iterate returns an Iterator over the ids of the collection of the type of
+// i. When l implements Pager, the ids are read a page of about limit ids at
+// a time, otherwise they are all read with List and iterated in process.
+func Iterate(l Lister, i Item, limit int) Iterator {
+	return IterateFrom(l, i, "", limit)
+}
+
+// IterateFrom is like Iterate, but starts from cursor, a cursor returned by
+// the Cursor method of an iterator over the same collection. The iterator
+// returns ErrInvalidCursor from Err when cursor is not empty and l doesn't
+// implement Pager.
+func IterateFrom(l Lister, i Item, cursor string, limit int) Iterator {
+	it := &iterator{lister: l, typ: reflect.TypeOf(i).Elem(), limit: limit, cursor: cursor}
+	it.pager, _ = l.(Pager)
+	if it.pager == nil && len(cursor) != 0 {
+		it.err = ErrInvalidCursor
+	}
+	return it
+}
+
+// iterator implements Iterator over the pages of a Pager, or over the ids
+// of a Lister as a single page
+type iterator struct {
+	lister Lister
+	pager  Pager
+	typ    reflect.Type
+	limit  int
+
+	// page holds the ids read last and pos the position of the next
+	page   reflect.Value
+	pos    int
+	cursor string
+	done   bool
+	item   Item
+	err    error
+}
+
+// Next advances the iterator, reading the next page when the ids of the
+// current page have been iterated
+func (it *iterator) Next() bool {
+	for {
+		if it.page.IsValid() && it.pos < it.page.Len() {
+			it.item = it.page.Index(it.pos).Addr().Interface().(Item)
+			it.pos++
+			return true
+		}
+		it.item = nil
+		if it.done || it.err != nil {
+			return false
+		}
+		dst := reflect.New(reflect.SliceOf(it.typ))
+		if it.pager != nil {
+			it.cursor, it.err = it.pager.ListPage(dst.Interface(), it.cursor, it.limit)
+			it.done = len(it.cursor) == 0
+		} else {
+			it.err = it.lister.List(dst.Interface())
+			it.done = true
+		}
+		if it.err != nil {
+			return false
+		}
+		it.page, it.pos = dst.Elem(), 0
+	}
+}
+
+// Item returns the current item
+func (it *iterator) Item() Item {
+	return it.item
+}
+
+// Err returns the error that stopped the iteration
+func (it *iterator) Err() error {
+	return it.err
+}
+
+// Cursor returns the cursor of the page after the current one
+func (it *iterator) Cursor() string {
+	return it.cursor
+}
+
+// Close stops the iteration and releases the page read last
+func (it *iterator) Close() error {
+	it.done = true
+	it.page = reflect.Value{}
+	it.item = nil
+	return nil
+}
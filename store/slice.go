@@ -0,0 +1,228 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrInvalidDestination means that the destination passed to List,
+// ReadMultiple or the other methods that populate a slice of items is not
+// one of the slices NewSlice accepts
+var ErrInvalidDestination = errors.New("store: destination must be a []T or []*T where *T implements Item, " +
+	"a pointer to one or to a [N]T or [N]*T array, or a []Item of sample items of a single type")
+
+var itemType = reflect.TypeOf((*Item)(nil)).Elem()
+
+// elem kinds of the slices of items
+const (
+	elemValue = iota
+	elemPtr
+	elemItem
+)
+
+// Slice is a destination of the stores that populate a slice of items, like
+// List and ReadMultiple. It is used by store implementations.
+type Slice struct {
+	v    reflect.Value
+	typ  reflect.Type
+	elem int
+}
+
+// NewSlice returns the Slice of dst, which is one of:
+//
+//	[]T or *[]T, where *T implements Item
+//	[]*T or *[]*T, where *T implements Item
+//	*[N]T or *[N]*T, where *T implements Item
+//	[]Item or *[]Item, holding at least one non-nil item
+//
+// The items of a []Item must all be of the same type, the type of the items
+// that are added to it. It returns ErrInvalidDestination for other values,
+// and ErrEmptyCollection when the items have no collection name, see
+// ValidateCollection. The slice must be passed by pointer for its length to change. Arrays are
+// passed by pointer so that their items are set, their length never
+// changes.
+func NewSlice(dst interface{}) (*Slice, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() == reflect.Ptr {
+		if v = v.Elem(); v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, ErrInvalidDestination
+		}
+	}
+	if v.Kind() != reflect.Slice && (v.Kind() != reflect.Array || !v.CanAddr()) {
+		return nil, ErrInvalidDestination
+	}
+	s := &Slice{v: v}
+	t := v.Type().Elem()
+	switch {
+	case t == itemType:
+		s.elem = elemItem
+		for n := 0; n < v.Len(); n++ {
+			if v.Index(n).IsNil() {
+				continue
+			}
+			it := v.Index(n).Elem().Type()
+			if it.Kind() != reflect.Ptr || (s.typ != nil && it.Elem() != s.typ) {
+				return nil, ErrInvalidDestination
+			}
+			s.typ = it.Elem()
+		}
+		if s.typ == nil {
+			return nil, ErrInvalidDestination
+		}
+	case t.Kind() == reflect.Ptr && t.Implements(itemType):
+		s.elem, s.typ = elemPtr, t.Elem()
+	case t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && reflect.PtrTo(t).Implements(itemType):
+		s.elem, s.typ = elemValue, t
+	default:
+		return nil, ErrInvalidDestination
+	}
+	if err := ValidateCollection(s.typ); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ItemType returns the type T of sample, an item *T, or of the items of
+// sample, a slice NewSlice accepts. It returns ErrInvalidDestination for
+// other values, and like NewSlice, ErrEmptyCollection when the items have no
+// collection name.
+func ItemType(sample interface{}) (reflect.Type, error) {
+	if t := reflect.TypeOf(sample); t != nil && t.Kind() == reflect.Ptr && t.Implements(itemType) {
+		if err := ValidateCollection(t); err != nil {
+			return nil, err
+		}
+		return t.Elem(), nil
+	}
+	s, err := NewSlice(sample)
+	if err != nil {
+		return nil, err
+	}
+	return s.typ, nil
+}
+
+// Type returns the type T of the items of the slice, where *T implements
+// Item
+func (s *Slice) Type() reflect.Type {
+	return s.typ
+}
+
+// Len returns the length of the slice
+func (s *Slice) Len() int {
+	return s.v.Len()
+}
+
+// New returns a new item of the type of the items of the slice
+func (s *Slice) New() Item {
+	return reflect.New(s.typ).Interface().(Item)
+}
+
+// Item returns the item at index n, nil elements of []*T and []Item
+// slices are set to new items first
+func (s *Slice) Item(n int) Item {
+	e := s.v.Index(n)
+	if s.elem == elemValue {
+		return e.Addr().Interface().(Item)
+	}
+	if e.IsNil() {
+		e.Set(reflect.ValueOf(s.New()))
+	}
+	return e.Interface().(Item)
+}
+
+// Set sets the item at index n to a copy of i, an item of the type of the
+// items of the slice. The items that elements of []*T and []Item point to
+// are replaced in place.
+func (s *Slice) Set(n int, i Item) {
+	e := s.v.Index(n)
+	if s.elem != elemValue {
+		if e.IsNil() {
+			e.Set(reflect.ValueOf(s.New()))
+		}
+		e = e.Elem()
+		if s.elem == elemItem {
+			e = e.Elem()
+		}
+	}
+	e.Set(reflect.ValueOf(i).Elem())
+}
+
+// SetLen sets the length of the slice to n, it returns
+// ErrInvalidDestination when the slice was not passed by pointer, or is an
+// array.
+func (s *Slice) SetLen(n int) error {
+	if n == s.v.Len() {
+		return nil
+	}
+	if !s.v.CanSet() || s.v.Kind() == reflect.Array {
+		return ErrInvalidDestination
+	}
+	if n > s.v.Cap() {
+		v := reflect.MakeSlice(s.v.Type(), n, n)
+		reflect.Copy(v, s.v)
+		s.v.Set(v)
+	} else {
+		s.v.SetLen(n)
+	}
+	return nil
+}
+
+// SetKeys populates the slice with new items with their keys set to keys
+func (s *Slice) SetKeys(keys []string) error {
+	if err := s.SetLen(len(keys)); err != nil {
+		return err
+	}
+	for n, key := range keys {
+		i := s.New()
+		i.SetKey(key)
+		if s.elem == elemValue {
+			s.Set(n, i)
+		} else {
+			s.v.Index(n).Set(reflect.ValueOf(i))
+		}
+	}
+	return nil
+}
+
+// RemoveNotFound removes the items that are not found from the slice, given
+// err, the error returned reading the items of the slice. It returns the
+// errors of the other items, or err when it is not a MultiError.
+func (s *Slice) RemoveNotFound(err error) error {
+	merr, ok := err.(MultiError)
+	if !ok {
+		return err
+	}
+	missing := make(map[int]bool)
+	var errs MultiError
+	for _, e := range merr {
+		if e.Err == ErrKeyNotFound {
+			missing[e.Index] = true
+		} else {
+			errs = append(errs, e)
+		}
+	}
+	// the items of arrays can't be removed
+	if len(missing) > 0 && s.v.Kind() == reflect.Array {
+		return ErrInvalidDestination
+	}
+	n := 0
+	for y := 0; y < s.v.Len(); y++ {
+		if missing[y] {
+			continue
+		}
+		if n != y {
+			s.v.Index(n).Set(s.v.Index(y))
+		}
+		n++
+	}
+	if err := s.SetLen(n); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSlice(t *testing.T) {
+	typ := reflect.TypeOf(testItem{})
+	for _, dst := range []interface{}{
+		[]testItem{}, &[]testItem{}, []*testItem{}, &[]*testItem{},
+		[]Item{nil, &testItem{}}, &[]Item{&testItem{}}, &[2]testItem{}, &[2]*testItem{},
+	} {
+		s, err := NewSlice(dst)
+		if err != nil {
+			t.Fatalf("%T: %v", dst, err)
+		}
+		if s.Type() != typ {
+			t.Fatalf("%T: expected type %v, got: %v", dst, typ, s.Type())
+		}
+	}
+	for _, dst := range []interface{}{
+		nil, testItem{}, &testItem{}, []int{}, []Item{}, []Item{nil},
+		[]Item{&testItem{}, &testCollection{}}, []**testItem{}, [2]testItem{}, &[2]int{},
+	} {
+		if _, err := NewSlice(dst); err != ErrInvalidDestination {
+			t.Fatalf("%T: expected ErrInvalidDestination, got: %v", dst, err)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	p := &testItem{ID: "a"}
+	items := []*testItem{p, nil}
+	s, err := NewSlice(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the items pointed to are replaced in place, nil items are allocated
+	s.Set(0, &testItem{ID: "b"})
+	if p.ID != "b" || s.Item(1) == nil || items[1] == nil {
+		t.Fatalf("expected the items to be set in place, got: %v %v", p, items[1])
+	}
+	if err := s.SetLen(3); err != ErrInvalidDestination {
+		t.Fatal("expected ErrInvalidDestination growing a slice not passed by pointer, got: ", err)
+	}
+
+	if s, err = NewSlice(&items); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetKeys([]string{"x", "y", "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[2].ID != "z" {
+		t.Fatalf("expected the keys to be set, got: %v", items)
+	}
+
+	// arrays are set in place, their length doesn't change
+	var array [2]testItem
+	if s, err = NewSlice(&array); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetKeys([]string{"x", "y"}); err != nil || array[1].ID != "y" {
+		t.Fatalf("expected the keys to be set, got: %v %v", array, err)
+	}
+	if err := s.SetLen(1); err != ErrInvalidDestination {
+		t.Fatal("expected ErrInvalidDestination changing the length of an array, got: ", err)
+	}
+	if typ, err := ItemType(&testItem{}); err != nil || typ != reflect.TypeOf(testItem{}) {
+		t.Fatal("expected testItem, got: ", typ, err)
+	}
+}
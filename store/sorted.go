@@ -0,0 +1,45 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+)
+
+// Sort describes the order and the window of the ids ListSorted returns.
+type Sort struct {
+	// Field is the numeric indexed field the ids are ordered by, by its Go
+	// name or the name it is stored under. The ids are ordered by the
+	// creation time of the items when empty.
+	Field string
+	// Descending orders the ids from the highest value, or the newest item
+	// when Field is empty
+	Descending bool
+	// Offset is the number of ids skipped, and Limit the max number of ids
+	// returned. All ids after Offset are returned when Limit is zero.
+	Offset int
+	Limit  int
+}
+
+// SortedLister is the interface that wraps the ListSorted method.
+//
+// ListSorted populates the slice dst with ids of the slice element type,
+// like List, in the order described by by. Items with equal values are
+// ordered by key, in reverse when descending. It returns ErrNotIndexed when
+// by.Field is not a numeric indexed field, see Index.
+//
+// The below example illustrates usage:
+//
+//	var newest []Hacker
+//	err := db.ListSorted(&newest, store.Sort{Descending: true, Limit: 10})
+type SortedLister interface {
+	ListSorted(dst interface{}, by Sort) error
+}
+
+// ContextSortedLister is the interface that wraps the ListSortedContext
+// method.
+type ContextSortedLister interface {
+	ListSortedContext(ctx context.Context, dst interface{}, by Sort) error
+}
@@ -15,7 +15,11 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // ErrKeyNotFound means that the object associated with the
@@ -25,6 +29,33 @@ var ErrKeyNotFound = errors.New("store: key not found")
 // ErrEmptyKey means that the key for the object provided is empty
 var ErrEmptyKey = errors.New("store: key is empty")
 
+// ErrInvalidKey means that the key for the object provided contains
+// characters stores do not accept, see ValidateKey
+var ErrInvalidKey = errors.New("store: key is invalid")
+
+// ErrConflict means that the object was modified in the datastore after the
+// version provided was read
+var ErrConflict = errors.New("store: version conflict")
+
+// ValidateKey returns ErrEmptyKey when key is empty, and ErrInvalidKey when
+// key is not valid UTF-8 or contains control characters such as newlines.
+// Stores validate the keys of items before reading, writing or deleting
+// them.
+func ValidateKey(key string) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if !utf8.ValidString(key) {
+		return ErrInvalidKey
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
 // Store is the interface to store implemented in package redis. It groups
 // ReadWriter, Lister and MultiReader interfaces.
 type Store interface {
@@ -41,6 +72,9 @@ type Store interface {
 // SetKey sets the item key. It is called by the store when Unmarshalling objects from
 // its underlying store.
 //
+// Keys may contain any printable characters, stores return ErrInvalidKey for
+// the keys rejected by ValidateKey.
+//
 // The below example illustrates usage:
 //
 //	type Hacker struct {
@@ -65,12 +99,46 @@ type Item interface {
 //
 // Write writes i to the underlying data store. It expects i.Key method
 // to return a unique identifier for the item, it will otherwise generate
-// a unique identifier and calls i.SetKey method. It returns any error
+// a unique identifier and calls i.SetKey method. The values previously
+// stored for the identifier are replaced as a whole. It returns any error
 // encountered that caused the write to stop early.
 type Writer interface {
 	Write(i Item) error
 }
 
+// Patcher is the interface that wraps the Patch method.
+//
+// Patch writes the fields of i over the values stored for i.Key, merging
+// them with the stored values instead of replacing them. It returns
+// ErrEmptyKey when the key is empty and ErrKeyNotFound when no item is
+// stored for the key.
+type Patcher interface {
+	Patch(i Item) error
+}
+
+// Updater is the interface that wraps the UpdateFields, Increment and
+// IncrementFloat methods.
+//
+// UpdateFields writes the values of fields, keyed by field name, to the item
+// stored for i.Key, leaving its other fields in place.
+//
+// Increment atomically adds delta to the integer field of the item stored for
+// i.Key and returns the new value. IncrementFloat does the same for float
+// fields. Pointer fields are incremented as the values they point to. Both
+// return an error, leaving the field unchanged, when the new value overflows
+// the type of the field.
+//
+// Field names follow the naming used by Marshal. They return ErrEmptyKey when
+// the key is empty, ErrKeyNotFound when no item is stored for the key and
+// ErrUnknownField when the item has no such field. UpdateFields checks the
+// version of items that implement Versioner the same way as Write, all of
+// them increment it.
+type Updater interface {
+	UpdateFields(i Item, fields map[string]interface{}) error
+	Increment(i Item, field string, delta int64) (int64, error)
+	IncrementFloat(i Item, field string, delta float64) (float64, error)
+}
+
 // Reader is the interface that wraps the basic Read method.
 //
 // Read reads i from the underlying data store and copies to i. It returns
@@ -87,6 +155,38 @@ type Deleter interface {
 	Delete(i Item) error
 }
 
+// Expirer is the interface that wraps the TTL method.
+//
+// TTL returns the duration after which the item expires and is removed
+// from the store. It is called by the store when writing items, items with a
+// TTL of zero or less don't expire.
+type Expirer interface {
+	TTL() time.Duration
+}
+
+// TTLSetter is the interface that wraps the SetTTL method.
+//
+// SetTTL sets the remaining time to live of the item. It is called by the
+// store when reading items, with zero when the item doesn't expire.
+type TTLSetter interface {
+	SetTTL(time.Duration)
+}
+
+// Versioner is the interface that wraps the Version and SetVersion methods.
+//
+// Version returns the version of the item, as last read from or written to
+// the store. It is zero for items that were never written. SetVersion sets
+// the version of the item, it is called by the store after reading and
+// writing the item.
+//
+// Stores write items that implement Versioner only when the version in the
+// store matches Version, and return ErrConflict otherwise. Each write
+// increments the version.
+type Versioner interface {
+	Version() int64
+	SetVersion(int64)
+}
+
 // ReadWriter is the interface that groups Reader, Writer and Deleter
 // interfaces.
 type ReadWriter interface {
@@ -96,15 +196,110 @@ type ReadWriter interface {
 }
 
 // Lister is the interface that wraps the basic List method.
+//
+// List populates the slice with the ids of the items of its element type.
+// It accepts the destinations NewSlice accepts, and returns
+// ErrInvalidDestination for others, as does ReadMultiple.
 type Lister interface {
 	List(interface{}) error
 }
 
+// Counter is the interface that wraps the Count method.
+//
+// Count returns the number of items of the collection of sample, an item or
+// a slice of items, without reading them.
+type Counter interface {
+	Count(sample interface{}) (int, error)
+}
+
+// Exister is the interface that wraps the Exists and ExistsMultiple methods.
+//
+// Exists reports whether an item is stored for i.Key, without reading it. It
+// returns ErrEmptyKey when the key is empty. ExistsMultiple reports it for
+// each of the items, in order.
+type Exister interface {
+	Exists(i Item) (bool, error)
+	ExistsMultiple(items []Item) ([]bool, error)
+}
+
 // MultiReader is the interface that wraps ReadMultiple method.
 type MultiReader interface {
 	ReadMultiple(interface{}) error
 }
 
+// FieldReader is the interface that wraps the ReadFields and
+// ReadMultipleFields methods.
+//
+// ReadFields reads only the fields named of the item, by their Go name or
+// the name they are stored under, leaving its other fields untouched. It
+// returns ErrUnknownField when the item has no such field, and like Read,
+// ErrKeyNotFound when no item is stored for the key. The fields named that
+// have no stored value, such as empty fields tagged omitempty, are set to
+// their zero value. All fields are read when none are named.
+//
+// ReadMultipleFields is like ReadMultiple, but reads only the fields named
+// of the items as ReadFields does. Items that fail are left untouched
+// rather than reset to their zero value.
+//
+// The below example illustrates usage:
+//
+//	h := &Hacker{Id: "ada"}
+//	err := db.ReadFields(h, "Name")
+type FieldReader interface {
+	ReadFields(i Item, fields ...string) error
+	ReadMultipleFields(dst interface{}, fields ...string) error
+}
+
+// KeyReader is the interface that wraps the ReadKeys method.
+//
+// ReadKeys populates the slice dst with the items of keys, in the order of
+// keys, without the items of dst having their keys set first as
+// ReadMultiple expects. Like ReadMultiple, it returns a MultiError with the
+// keys that are not found, unless the SkipMissing option is passed, which
+// leaves those items out of dst instead. The indexes of the MultiError are
+// the indexes of keys.
+type KeyReader interface {
+	ReadKeys(keys []string, dst interface{}, opts ...ReadOption) error
+}
+
+// ReadOption is an option of ReadKeys
+type ReadOption func(*ReadOptions)
+
+// ReadOptions holds the options of a read, it is used by store
+// implementations.
+type ReadOptions struct {
+	// SkipMissing is set by the SkipMissing option
+	SkipMissing bool
+	// Fields are the fields passed to the Fields option, all fields are
+	// read when empty
+	Fields []string
+}
+
+// SkipMissing leaves the items that are not found out of the destination of
+// ReadKeys
+var SkipMissing ReadOption = func(o *ReadOptions) {
+	o.SkipMissing = true
+}
+
+// Fields reads only the fields named of the items read by ReadKeys, by their
+// Go name or the name they are stored under, leaving their other fields
+// untouched as FieldReader does
+func Fields(names ...string) ReadOption {
+	return func(o *ReadOptions) {
+		o.Fields = append(o.Fields, names...)
+	}
+}
+
+// NewReadOptions returns the ReadOptions set by opts, it is used by store
+// implementations.
+func NewReadOptions(opts []ReadOption) ReadOptions {
+	var o ReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 // MultiWriter is the interface that wraps WriteMultiple method.
 type MultiWriter interface {
 	WriteMultiple(items []Item) error
@@ -122,3 +317,111 @@ type MultiReadWriter interface {
 	MultiWriter
 	MultiDeleter
 }
+
+// ContextStore is the interface that groups the context-aware variants of
+// the Store interfaces. It is implemented in package redis.
+//
+// Implementations are expected to stop early and return ctx.Err() when ctx
+// is done before the operation completes.
+type ContextStore interface {
+	ContextReadWriter
+	ContextLister
+	ContextMultiReadWriter
+}
+
+// ContextWriter is the interface that wraps the WriteContext method.
+//
+// WriteContext is like Writer.Write but accepts a context.
+type ContextWriter interface {
+	WriteContext(ctx context.Context, i Item) error
+}
+
+// ContextReader is the interface that wraps the ReadContext method.
+//
+// ReadContext is like Reader.Read but accepts a context.
+type ContextReader interface {
+	ReadContext(ctx context.Context, i Item) error
+}
+
+// ContextDeleter is the interface that wraps the DeleteContext method.
+//
+// DeleteContext is like Deleter.Delete but accepts a context.
+type ContextDeleter interface {
+	DeleteContext(ctx context.Context, i Item) error
+}
+
+// ContextPatcher is the interface that wraps the PatchContext method.
+//
+// PatchContext is like Patcher.Patch but accepts a context.
+type ContextPatcher interface {
+	PatchContext(ctx context.Context, i Item) error
+}
+
+// ContextUpdater is the interface that wraps the UpdateFieldsContext,
+// IncrementContext and IncrementFloatContext methods, the context-aware
+// variants of the Updater methods.
+type ContextUpdater interface {
+	UpdateFieldsContext(ctx context.Context, i Item, fields map[string]interface{}) error
+	IncrementContext(ctx context.Context, i Item, field string, delta int64) (int64, error)
+	IncrementFloatContext(ctx context.Context, i Item, field string, delta float64) (float64, error)
+}
+
+// ContextReadWriter is the interface that groups ContextReader, ContextWriter
+// and ContextDeleter interfaces.
+type ContextReadWriter interface {
+	ContextReader
+	ContextWriter
+	ContextDeleter
+}
+
+// ContextLister is the interface that wraps the ListContext method.
+type ContextLister interface {
+	ListContext(ctx context.Context, i interface{}) error
+}
+
+// ContextCounter is the interface that wraps the CountContext method.
+type ContextCounter interface {
+	CountContext(ctx context.Context, sample interface{}) (int, error)
+}
+
+// ContextExister is the interface that wraps the ExistsContext and
+// ExistsMultipleContext methods.
+type ContextExister interface {
+	ExistsContext(ctx context.Context, i Item) (bool, error)
+	ExistsMultipleContext(ctx context.Context, items []Item) ([]bool, error)
+}
+
+// ContextMultiReader is the interface that wraps ReadMultipleContext method.
+type ContextMultiReader interface {
+	ReadMultipleContext(ctx context.Context, i interface{}) error
+}
+
+// ContextFieldReader is the interface that wraps the ReadFieldsContext and
+// ReadMultipleFieldsContext methods.
+type ContextFieldReader interface {
+	ReadFieldsContext(ctx context.Context, i Item, fields ...string) error
+	ReadMultipleFieldsContext(ctx context.Context, dst interface{}, fields ...string) error
+}
+
+// ContextKeyReader is the interface that wraps ReadKeysContext method.
+type ContextKeyReader interface {
+	ReadKeysContext(ctx context.Context, keys []string, dst interface{}, opts ...ReadOption) error
+}
+
+// ContextMultiWriter is the interface that wraps WriteMultipleContext method.
+type ContextMultiWriter interface {
+	WriteMultipleContext(ctx context.Context, items []Item) error
+}
+
+// ContextMultiDeleter is the interface that wraps DeleteMultipleContext method.
+type ContextMultiDeleter interface {
+	DeleteMultipleContext(ctx context.Context, items []Item) (int, error)
+}
+
+// ContextMultiReadWriter is the interface that groups ContextMultiReader,
+// ContextMultiWriter and ContextMultiDeleter interfaces.
+type ContextMultiReadWriter interface {
+	ContextMultiReader
+	ContextMultiWriter
+	ContextMultiDeleter
+}
@@ -0,0 +1,39 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package store
+
+import (
+	"strings"
+)
+
+// tagOptions is the string following a comma in a store struct field tag,
+// following the conventions of the encoding/json package.
+type tagOptions string
+
+// parseTag splits a store struct field tag into its name and its comma
+// separated options.
+func parseTag(tag string) (string, tagOptions) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tagOptions(tag[idx+1:])
+	}
+	return tag, tagOptions("")
+}
+
+// Contains reports whether a comma-separated list of options contains a
+// particular option.
+func (o tagOptions) Contains(option string) bool {
+	s := string(o)
+	for s != "" {
+		var next string
+		if idx := strings.Index(s, ","); idx >= 0 {
+			s, next = s[:idx], s[idx+1:]
+		}
+		if s == option {
+			return true
+		}
+		s = next
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package store
+
+import (
+	"context"
+)
+
+// Typed wraps a Store with type-safe methods for items of type T, where *T
+// implements Item. Using Typed, passing a value that is not a slice of
+// items to List or ReadMultiple fails at compile time rather than at run
+// time.
+//
+// The context is passed on when the wrapped store implements the matching
+// ContextStore method, otherwise it is only checked before the call.
+//
+// The below example illustrates usage:
+//
+//	hackers := store.NewTyped[Hacker](db)
+//	alan, err := hackers.Get(ctx, id)
+type Typed[T any, PT interface {
+	*T
+	Item
+}] struct {
+	store Store
+}
+
+// NewTyped returns a Typed wrapping s for items of type T.
+func NewTyped[T any, PT interface {
+	*T
+	Item
+}](s Store) *Typed[T, PT] {
+	return &Typed[T, PT]{store: s}
+}
+
+// Store returns the wrapped store.
+func (t *Typed[T, PT]) Store() Store {
+	return t.store
+}
+
+// Get reads the item with the key from the store. It returns ErrKeyNotFound
+// when no item exists for the key.
+func (t *Typed[T, PT]) Get(ctx context.Context, key string) (T, error) {
+	var v T
+	PT(&v).SetKey(key)
+	var err error
+	if s, ok := t.store.(ContextReader); ok {
+		err = s.ReadContext(ctx, PT(&v))
+	} else if err = ctx.Err(); err == nil {
+		err = t.store.Read(PT(&v))
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// Put writes v to the store. Like Writer.Write, it assigns a unique key to v
+// when its key is empty.
+func (t *Typed[T, PT]) Put(ctx context.Context, v PT) error {
+	if s, ok := t.store.(ContextWriter); ok {
+		return s.WriteContext(ctx, v)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.store.Write(v)
+}
+
+// Delete deletes the item with the key from the store.
+func (t *Typed[T, PT]) Delete(ctx context.Context, key string) error {
+	var v T
+	PT(&v).SetKey(key)
+	if s, ok := t.store.(ContextDeleter); ok {
+		return s.DeleteContext(ctx, PT(&v))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.store.Delete(PT(&v))
+}
+
+// List returns the items in the store with only their keys populated.
+func (t *Typed[T, PT]) List(ctx context.Context) ([]T, error) {
+	var items []T
+	if s, ok := t.store.(ContextLister); ok {
+		if err := s.ListContext(ctx, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := t.store.List(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetMany reads the items with the keys from the store in a single call. The
+// items are returned in the order of keys. When some items fail, such as
+// items that are not found, the other items are returned along with a
+// MultiError.
+func (t *Typed[T, PT]) GetMany(ctx context.Context, keys []string) ([]T, error) {
+	items := make([]T, len(keys))
+	for n, key := range keys {
+		PT(&items[n]).SetKey(key)
+	}
+	var err error
+	if s, ok := t.store.(ContextMultiReader); ok {
+		err = s.ReadMultipleContext(ctx, items)
+	} else if err = ctx.Err(); err == nil {
+		err = t.store.ReadMultiple(items)
+	}
+	if _, ok := err.(MultiError); ok {
+		return items, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,1670 @@
+// Copyright 2015 Greg Osuri. All rights reserved.
+// Use of this source code is governed by the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package storetest implements a conformance test suite for implementations
+// of the store.Store interface.
+//
+// Backends prove compatibility by running the suite from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.RunConformance(t, func() store.Store {
+//			return mystore.New(uniqueNamespace())
+//		})
+//	}
+package storetest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosuri/go-store/store"
+)
+
+// Record is the item written by the conformance tests. It has a field of
+// every supported kind and an unexported field that stores must ignore.
+type Record struct {
+	ID         string
+	Field      string
+	FieldInt   int
+	FieldInt64 int64
+	FieldUint  uint
+	FieldFloat float32
+	FieldBool  bool
+
+	fieldPrivate string
+}
+
+// Key implements store.Item
+func (r *Record) Key() string {
+	return r.ID
+}
+
+// SetKey implements store.Item
+func (r *Record) SetKey(k string) {
+	r.ID = k
+}
+
+// Other is a second item type used to verify that stores isolate items of
+// different types.
+type Other struct {
+	ID    string
+	Field string
+}
+
+// Key implements store.Item
+func (o *Other) Key() string {
+	return o.ID
+}
+
+// SetKey implements store.Item
+func (o *Other) SetKey(k string) {
+	o.ID = k
+}
+
+// Indexed is an item with indexed fields, used to test stores that
+// implement store.Finder.
+type Indexed struct {
+	ID    string
+	Name  string  `store:",index"`
+	Age   int     `store:",index"`
+	Score float64 `store:",index"`
+	Note  string
+}
+
+// Key implements store.Item
+func (x *Indexed) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Indexed) SetKey(k string) {
+	x.ID = k
+}
+
+// Order is an item with an indexed time field, used to test stores that
+// implement store.SortedLister.
+type Order struct {
+	ID        string
+	CreatedAt time.Time `store:",index"`
+}
+
+// Key implements store.Item
+func (x *Order) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Order) SetKey(k string) {
+	x.ID = k
+}
+
+// Session is an item that expires, it implements store.Expirer and
+// store.TTLSetter.
+type Session struct {
+	ID   string
+	User string
+
+	ttl time.Duration
+}
+
+// Key implements store.Item
+func (x *Session) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Session) SetKey(k string) {
+	x.ID = k
+}
+
+// TTL implements store.Expirer
+func (x *Session) TTL() time.Duration {
+	return x.ttl
+}
+
+// SetTTL implements store.TTLSetter
+func (x *Session) SetTTL(ttl time.Duration) {
+	x.ttl = ttl
+}
+
+// Account is a versioned item, it implements store.Versioner.
+type Account struct {
+	ID      string
+	Balance int
+
+	version int64
+}
+
+// Key implements store.Item
+func (x *Account) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Account) SetKey(k string) {
+	x.ID = k
+}
+
+// Version implements store.Versioner
+func (x *Account) Version() int64 {
+	return x.version
+}
+
+// SetVersion implements store.Versioner
+func (x *Account) SetVersion(v int64) {
+	x.version = v
+}
+
+// Tagged is an item with fields renamed, omitted when empty and skipped by
+// their store struct field tags.
+type Tagged struct {
+	ID     string `store:"id"`
+	Name   string `store:"name,omitempty"`
+	Count  int    `store:"count,omitempty"`
+	Secret string `store:"-"`
+}
+
+// Key implements store.Item
+func (x *Tagged) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Tagged) SetKey(k string) {
+	x.ID = k
+}
+
+// Event is an item with time, duration, byte slice and pointer fields.
+type Event struct {
+	ID      string
+	At      time.Time
+	Timeout time.Duration
+	Token   []byte
+	Limit   *int
+	Note    *string
+}
+
+// Key implements store.Item
+func (x *Event) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Event) SetKey(k string) {
+	x.ID = k
+}
+
+// Keyless is an item whose key is not stored as one of its fields, it has no
+// stored fields when Name is empty.
+type Keyless struct {
+	ID   string `store:"-"`
+	Name string `store:",omitempty"`
+}
+
+// Key implements store.Item
+func (x *Keyless) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Keyless) SetKey(k string) {
+	x.ID = k
+}
+
+// Counter is an item with small and pointer numeric fields.
+type Counter struct {
+	ID    string
+	Hits  *int
+	Small int8
+	Ratio *float32
+}
+
+// Key implements store.Item
+func (x *Counter) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Counter) SetKey(k string) {
+	x.ID = k
+}
+
+// Address is a nested struct of Profile.
+type Address struct {
+	City string
+	Zip  string
+}
+
+// Base is embedded in Profile, its fields are stored as fields of Profile.
+type Base struct {
+	ID      string
+	Created time.Time
+}
+
+// Profile is an item with embedded, nested struct, slice and map fields.
+type Profile struct {
+	Base
+	Home *Address
+	Tags []string
+	Meta map[string]string
+}
+
+// Key implements store.Item
+func (x *Profile) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Profile) SetKey(k string) {
+	x.ID = k
+}
+
+// Price is an item that converts itself, it implements store.Marshaler and
+// store.Unmarshaler. The amount is stored in cents.
+type Price struct {
+	ID     string
+	Amount float64
+}
+
+// Key implements store.Item
+func (x *Price) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *Price) SetKey(k string) {
+	x.ID = k
+}
+
+// MarshalStore implements store.Marshaler
+func (x *Price) MarshalStore() (map[string][]byte, error) {
+	// rounded, amounts are not negative
+	cents := int64(x.Amount*100 + 0.5)
+	return map[string][]byte{"cents": []byte(strconv.FormatInt(cents, 10))}, nil
+}
+
+// UnmarshalStore implements store.Unmarshaler
+func (x *Price) UnmarshalStore(data map[string][]byte) error {
+	b, ok := data["cents"]
+	if !ok {
+		return nil
+	}
+	cents, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return err
+	}
+	x.Amount = float64(cents) / 100
+	return nil
+}
+
+// RecordView is an item stored in the collection of Record, it implements
+// store.Collection.
+type RecordView struct {
+	ID    string
+	Field string
+}
+
+// Key implements store.Item
+func (x *RecordView) Key() string {
+	return x.ID
+}
+
+// SetKey implements store.Item
+func (x *RecordView) SetKey(k string) {
+	x.ID = k
+}
+
+// CollectionName implements store.Collection
+func (x *RecordView) CollectionName() string {
+	return "Record"
+}
+
+// Unsupported is an item with a field of a kind that stores can't convert.
+type Unsupported struct {
+	ID      string
+	Channel chan int
+}
+
+// Key implements store.Item
+func (u *Unsupported) Key() string {
+	return u.ID
+}
+
+// SetKey implements store.Item
+func (u *Unsupported) SetKey(k string) {
+	u.ID = k
+}
+
+// RunConformance runs the conformance test suite against the stores returned
+// by factory. Each call to factory must return an empty store, isolated from
+// the stores returned by other calls, for example by using a unique
+// namespace.
+//
+// Tests of optional interfaces, such as store.Finder, are skipped when the
+// store doesn't implement them.
+func RunConformance(t *testing.T, factory func() store.Store) {
+	RunConformanceExcept(t, factory)
+}
+
+// RunConformanceExcept is like RunConformance but skips the tests named,
+// such as "Updater", for stores that knowingly don't support a feature.
+func RunConformanceExcept(t *testing.T, factory func() store.Store, skip ...string) {
+	skipped := make(map[string]bool, len(skip))
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	tests := []struct {
+		name string
+		fn   func(*testing.T, func() store.Store)
+	}{
+		{"Write", testWrite},
+		{"WriteUnsupported", testWriteUnsupported},
+		{"Read", testRead},
+		{"ReadNotFound", testReadNotFound},
+		{"Tags", testTags},
+		{"NoFields", testNoFields},
+		{"FieldTypes", testFieldTypes},
+		{"Nested", testNested},
+		{"Marshaler", testMarshaler},
+		{"Delete", testDelete},
+		{"DeleteMultiple", testDeleteMultiple},
+		{"WriteMultiple", testWriteMultiple},
+		{"ReadMultiple", testReadMultiple},
+		{"Destinations", testDestinations},
+		{"ReadKeys", testReadKeys},
+		{"ReadFields", testReadFields},
+		{"List", testList},
+		{"ListPage", testListPage},
+		{"Iterate", testIterate},
+		{"Count", testCount},
+		{"Exists", testExists},
+		{"TypeIsolation", testTypeIsolation},
+		{"Collection", testCollection},
+		{"NamespaceIsolation", testNamespaceIsolation},
+		{"Keys", testKeys},
+		{"Patch", testPatch},
+		{"Updater", testUpdater},
+		{"Expiry", testExpiry},
+		{"Versioning", testVersioning},
+		{"Finder", testFinder},
+		{"ListSorted", testListSorted},
+	}
+	for _, tt := range tests {
+		fn := tt.fn
+		if skipped[tt.name] {
+			t.Run(tt.name, func(t *testing.T) { t.Skip("skipped by the store") })
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) { fn(t, factory) })
+	}
+}
+
+// checkItemErrors fails the test unless err is a store.MultiError with the
+// errors exp of the items by index
+func checkItemErrors(t *testing.T, err error, exp map[int]error) {
+	merr, ok := err.(store.MultiError)
+	if !ok {
+		t.Fatal("expected a MultiError, got: ", err)
+	}
+	got := make(map[int]error)
+	for _, e := range merr {
+		got[e.Index] = e.Err
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %v \ngot: %v", exp, got)
+	}
+}
+
+func newRecord(field string, n int) *Record {
+	return &Record{
+		Field:        field,
+		FieldInt:     -n,
+		FieldInt64:   int64(n) << 40,
+		FieldUint:    uint(n),
+		FieldFloat:   1.25 * float32(n),
+		FieldBool:    n%2 == 0,
+		fieldPrivate: "private",
+	}
+}
+
+// public returns a copy of r as it is expected to be read back
+func public(r *Record) Record {
+	c := *r
+	c.fieldPrivate = ""
+	return c
+}
+
+func testWrite(t *testing.T, factory func() store.Store) {
+	db := factory()
+
+	r := newRecord("value", 1)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(r.Key()) == 0 {
+		t.Fatal("expected Write to assign a key using SetKey")
+	}
+
+	keyed := newRecord("keyed", 2)
+	keyed.SetKey("keyed-record")
+	if err := db.Write(keyed); err != nil {
+		t.Fatal("err", err)
+	}
+	if keyed.Key() != "keyed-record" {
+		t.Fatal("expected Write to keep the key, got: ", keyed.Key())
+	}
+
+	// writing again overwrites the stored values
+	keyed.Field = "updated"
+	if err := db.Write(keyed); err != nil {
+		t.Fatal("err", err)
+	}
+	got := &Record{ID: keyed.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.Field != "updated" {
+		t.Fatal("expected updated field, got: ", got.Field)
+	}
+}
+
+func testWriteUnsupported(t *testing.T, factory func() store.Store) {
+	db := factory()
+	if err := db.Write(&Unsupported{ID: "id", Channel: make(chan int)}); err == nil {
+		t.Fatal("expected error writing unsupported field kind")
+	}
+	err := db.WriteMultiple([]store.Item{&Record{}, &Unsupported{ID: "id"}})
+	if merr, ok := err.(store.MultiError); !ok || len(merr) != 1 || merr.Err(1) == nil {
+		t.Fatal("expected a MultiError for the unsupported item, got: ", err)
+	}
+}
+
+func testRead(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r := newRecord("value", 3)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Record{ID: r.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := public(r); !reflect.DeepEqual(*got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+}
+
+func testTags(t *testing.T, factory func() store.Store) {
+	db := factory()
+	x := &Tagged{Name: "name", Secret: "secret"}
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Tagged{ID: x.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (Tagged{ID: x.Key(), Name: "name"}); !reflect.DeepEqual(*got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+
+	all := []Tagged{{ID: x.Key()}}
+	if err := db.ReadMultiple(all); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (Tagged{ID: x.Key(), Name: "name"}); !reflect.DeepEqual(all[0], exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, all[0])
+	}
+
+	// omitted fields are read as empty, fields that are never stored are
+	// left untouched
+	if err := db.Write(&Tagged{ID: x.Key()}); err != nil {
+		t.Fatal("err", err)
+	}
+	got = &Tagged{ID: x.Key(), Name: "stale", Count: 1, Secret: "kept"}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (Tagged{ID: x.Key(), Secret: "kept"}); !reflect.DeepEqual(*got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+}
+
+func testNoFields(t *testing.T, factory func() store.Store) {
+	db := factory()
+	x := &Keyless{}
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+	got := &Keyless{ID: x.Key(), Name: "stale"}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if *got != *x {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, got)
+	}
+	var list []Keyless
+	if err := db.List(&list); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(list) != 1 || list[0].ID != x.Key() {
+		t.Fatalf("expected [%q], got: %v", x.Key(), list)
+	}
+}
+
+func testFieldTypes(t *testing.T, factory func() store.Store) {
+	db := factory()
+	limit := 3
+	x := &Event{
+		At:      time.Date(2015, 10, 18, 9, 30, 0, 500, time.UTC),
+		Timeout: 90 * time.Second,
+		Token:   []byte{0, 0xff, 'a'},
+		Limit:   &limit,
+	}
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Event{ID: x.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, x) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, got)
+	}
+
+	all := []Event{{ID: x.Key()}}
+	if err := db.ReadMultiple(all); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(&all[0], x) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, all[0])
+	}
+
+	// nil pointers are read as nil
+	x.Limit = nil
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+	got = &Event{ID: x.Key(), Limit: &limit}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.Limit != nil {
+		t.Fatal("expected a nil limit, got: ", *got.Limit)
+	}
+}
+
+func testNested(t *testing.T, factory func() store.Store) {
+	db := factory()
+	x := &Profile{
+		Base: Base{Created: time.Date(2015, 10, 18, 0, 0, 0, 0, time.UTC)},
+		Home: &Address{City: "Paris", Zip: "75001"},
+		Tags: []string{"a", "b"},
+		Meta: map[string]string{"color": "red"},
+	}
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Profile{Base: Base{ID: x.Key()}}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, x) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, got)
+	}
+
+	all := []Profile{{Base: Base{ID: x.Key()}}}
+	if err := db.ReadMultiple(all); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(&all[0], x) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, all[0])
+	}
+}
+
+func testMarshaler(t *testing.T, factory func() store.Store) {
+	db := factory()
+	x, y := &Price{Amount: 12.34}, &Price{Amount: 0.5}
+	if err := db.Write(x); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.WriteMultiple([]store.Item{y}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Price{ID: x.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(got, x) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", x, got)
+	}
+
+	all := []Price{{ID: x.Key()}, {ID: y.Key()}}
+	if err := db.ReadMultiple(all); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []Price{*x, *y}; !reflect.DeepEqual(all, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, all)
+	}
+}
+
+func testReadNotFound(t *testing.T, factory func() store.Store) {
+	db := factory()
+	if err := db.Read(&Record{ID: "missing"}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := db.Read(&Record{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+}
+
+func testDelete(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r := newRecord("value", 4)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Delete(&Record{ID: r.Key()}); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Read(&Record{ID: r.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound after delete, got: ", err)
+	}
+	if err := db.Delete(&Record{ID: r.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := db.Delete(&Record{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+}
+
+func testDeleteMultiple(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r, r1 := newRecord("value", 5), newRecord("value1", 6)
+	if err := db.WriteMultiple([]store.Item{r, r1}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	count, err := db.DeleteMultiple([]store.Item{r, &Record{ID: "missing"}, r1, &Record{}})
+	checkItemErrors(t, err, map[int]error{1: store.ErrKeyNotFound, 3: store.ErrEmptyKey})
+	if count != 2 {
+		t.Fatal("expected 2 deletions, got: ", count)
+	}
+
+	if count, err = db.DeleteMultiple([]store.Item{}); err != nil || count != 0 {
+		t.Fatalf("expected no deletions without error, got: %d, %v", count, err)
+	}
+}
+
+func testWriteMultiple(t *testing.T, factory func() store.Store) {
+	db := factory()
+	items := []*Record{newRecord("a", 7), newRecord("b", 8), newRecord("c", 9)}
+	items[0].SetKey("multi-record")
+	if err := db.WriteMultiple([]store.Item{items[0], items[1], items[2]}); err != nil {
+		t.Fatal("err", err)
+	}
+	if items[0].Key() != "multi-record" {
+		t.Fatal("expected WriteMultiple to keep the key, got: ", items[0].Key())
+	}
+	for _, r := range items {
+		if len(r.Key()) == 0 {
+			t.Fatal("expected WriteMultiple to assign a key using SetKey")
+		}
+		got := &Record{ID: r.Key()}
+		if err := db.Read(got); err != nil {
+			t.Fatal("err", err)
+		}
+		if exp := public(r); !reflect.DeepEqual(*got, exp) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+		}
+	}
+
+	if err := db.WriteMultiple([]store.Item{}); err != nil {
+		t.Fatal("err", err)
+	}
+}
+
+func testReadMultiple(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r, r1 := newRecord("a", 10), newRecord("b", 11)
+	if err := db.WriteMultiple([]store.Item{r, r1}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := []Record{{ID: r.Key()}, {ID: r1.Key()}}
+	if err := db.ReadMultiple(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []Record{public(r), public(r1)}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	// the other items are read when some fail
+	got = []Record{{ID: r.Key()}, {}, {ID: "missing"}, {ID: r1.Key()}}
+	err := db.ReadMultiple(got)
+	checkItemErrors(t, err, map[int]error{1: store.ErrEmptyKey, 2: store.ErrKeyNotFound})
+	if exp := []Record{public(r), {}, {}, public(r1)}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	if err := db.ReadMultiple([]Record{}); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.ReadMultiple(&Record{ID: r.Key()}); err == nil {
+		t.Fatal("expected error reading into a non-slice")
+	}
+}
+
+func testDestinations(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r, r1 := newRecord("a", 1), newRecord("b", 2)
+	if err := db.WriteMultiple([]store.Item{r, r1}); err != nil {
+		t.Fatal("err", err)
+	}
+	exp := map[string]Record{r.Key(): public(r), r1.Key(): public(r1)}
+
+	// the items of []*T are read in place
+	p, p1 := &Record{ID: r.Key()}, &Record{ID: r1.Key()}
+	if err := db.ReadMultiple([]*Record{p, p1}); err != nil {
+		t.Fatal("err", err)
+	}
+	if *p != exp[r.Key()] || *p1 != exp[r1.Key()] {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v %#v", exp, p, p1)
+	}
+	// the items of arrays passed by pointer are read in place
+	array := [2]Record{{ID: r1.Key()}, {ID: r.Key()}}
+	if err := db.ReadMultiple(&array); err != nil {
+		t.Fatal("err", err)
+	}
+	if array[0] != exp[r1.Key()] || array[1] != exp[r.Key()] {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, array)
+	}
+	items := []store.Item{&Record{ID: r1.Key()}}
+	if err := db.ReadMultiple(items); err != nil {
+		t.Fatal("err", err)
+	}
+	if got := *items[0].(*Record); got != exp[r1.Key()] {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp[r1.Key()], got)
+	}
+
+	var ptrs []*Record
+	if err := db.List(&ptrs); err != nil || len(ptrs) != 2 {
+		t.Fatal("expected 2 items, got: ", len(ptrs), err)
+	}
+	for _, p := range ptrs {
+		if _, ok := exp[p.ID]; !ok {
+			t.Fatal("unexpected key in list: ", p.ID)
+		}
+	}
+	items = []store.Item{&Record{}}
+	if err := db.List(&items); err != nil || len(items) != 2 {
+		t.Fatal("expected 2 items, got: ", len(items), err)
+	}
+	for _, i := range items {
+		if _, ok := exp[i.(*Record).ID]; !ok {
+			t.Fatal("unexpected key in list: ", i.Key())
+		}
+	}
+
+	for _, dst := range []interface{}{nil, Record{}, &Record{}, &[]int{}, &[]store.Item{}, []Record{}, []store.Item{&Record{}, &Other{}}} {
+		if err := db.List(dst); err != store.ErrInvalidDestination {
+			t.Fatalf("list %T: expected ErrInvalidDestination, got: %v", dst, err)
+		}
+	}
+	if err := db.ReadMultiple([]string{r.Key()}); err != store.ErrInvalidDestination {
+		t.Fatal("expected ErrInvalidDestination, got: ", err)
+	}
+}
+
+func testReadKeys(t *testing.T, factory func() store.Store) {
+	db := factory()
+	reader, ok := db.(store.KeyReader)
+	if !ok {
+		t.Skip("store does not implement store.KeyReader")
+	}
+	r, r1 := newRecord("a", 1), newRecord("b", 2)
+	if err := db.WriteMultiple([]store.Item{r, r1}); err != nil {
+		t.Fatal("err", err)
+	}
+	keys := []string{r1.Key(), "missing", r.Key()}
+
+	var got []Record
+	checkItemErrors(t, reader.ReadKeys(keys, &got), map[int]error{1: store.ErrKeyNotFound})
+	if exp := []Record{public(r1), {}, public(r)}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	var ptrs []*Record
+	if err := reader.ReadKeys(keys, &ptrs, store.SkipMissing); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(ptrs) != 2 || *ptrs[0] != public(r1) || *ptrs[1] != public(r) {
+		t.Fatalf("expected the items found in the order of keys, got: %v", ptrs)
+	}
+
+	// errors other than missing keys are reported with SkipMissing
+	err := reader.ReadKeys([]string{"missing", ""}, &got, store.SkipMissing)
+	checkItemErrors(t, err, map[int]error{1: store.ErrEmptyKey})
+}
+
+func testReadFields(t *testing.T, factory func() store.Store) {
+	db := factory()
+	reader, ok := db.(store.FieldReader)
+	if !ok {
+		t.Skip("store does not implement store.FieldReader")
+	}
+	r, r1 := newRecord("a", 1), newRecord("b", 2)
+	if err := db.WriteMultiple([]store.Item{r, r1}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	// the fields not read are left untouched
+	got := []Record{{ID: r.Key(), FieldInt: 7}, {ID: r1.Key(), FieldInt: 7}}
+	if err := reader.ReadMultipleFields(got, "Field", "FieldBool"); err != nil {
+		t.Fatal("err", err)
+	}
+	exp := []Record{
+		{ID: r.Key(), Field: r.Field, FieldInt: 7, FieldBool: r.FieldBool},
+		{ID: r1.Key(), Field: r1.Field, FieldInt: 7, FieldBool: r1.FieldBool},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+	if err := reader.ReadMultipleFields(got, "Unknown"); err != store.ErrUnknownField {
+		t.Fatal("expected ErrUnknownField, got: ", err)
+	}
+	missing := []Record{{ID: "missing", FieldInt: 7}}
+	checkItemErrors(t, reader.ReadMultipleFields(missing, "Field"), map[int]error{0: store.ErrKeyNotFound})
+	if exp := []Record{{ID: "missing", FieldInt: 7}}; !reflect.DeepEqual(missing, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, missing)
+	}
+
+	if keyReader, ok := db.(store.KeyReader); ok {
+		var got []Record
+		if err := keyReader.ReadKeys([]string{r1.Key(), "missing"}, &got, store.Fields("FieldUint"), store.SkipMissing); err != nil {
+			t.Fatal("err", err)
+		}
+		if exp := []Record{{ID: r1.Key(), FieldUint: r1.FieldUint}}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+		}
+	}
+
+	one := &Record{ID: r.Key(), Field: "untouched"}
+	if err := reader.ReadFields(one, "FieldInt64"); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&Record{ID: r.Key(), Field: "untouched", FieldInt64: r.FieldInt64}); !reflect.DeepEqual(one, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, one)
+	}
+	if err := reader.ReadFields(&Record{ID: "missing"}, "Field"); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := reader.ReadFields(&Record{ID: r.Key()}, "fieldPrivate"); err != store.ErrUnknownField {
+		t.Fatal("expected ErrUnknownField, got: ", err)
+	}
+
+	// fields are named by their Go name or the name they are stored under,
+	// fields read that are not stored are empty
+	tagged := &Tagged{ID: "tagged", Name: "ada", Count: 2}
+	if err := db.Write(tagged); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Write(&Tagged{ID: "empty"}); err != nil {
+		t.Fatal("err", err)
+	}
+	gotTagged := &Tagged{ID: "tagged"}
+	if err := reader.ReadFields(gotTagged, "name", "Count"); err != nil {
+		t.Fatal("err", err)
+	}
+	if !reflect.DeepEqual(gotTagged, tagged) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", tagged, gotTagged)
+	}
+	empty := &Tagged{ID: "empty", Name: "stale", Count: 2}
+	if err := reader.ReadFields(empty, "name"); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (&Tagged{ID: "empty", Count: 2}); !reflect.DeepEqual(empty, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, empty)
+	}
+}
+
+func testList(t *testing.T, factory func() store.Store) {
+	db := factory()
+
+	var got []Record
+	if err := db.List(&got); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(got) != 0 {
+		t.Fatal("expected empty list, got: ", len(got))
+	}
+
+	keys := make(map[string]bool)
+	for n := 0; n < 25; n++ {
+		r := newRecord("list", n)
+		if err := db.Write(r); err != nil {
+			t.Fatal("err", err)
+		}
+		keys[r.Key()] = true
+	}
+
+	if err := db.List(&got); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("expected length to be %d, got: %d", len(keys), len(got))
+	}
+	for _, r := range got {
+		if !keys[r.ID] {
+			t.Fatal("unexpected key in list: ", r.ID)
+		}
+		delete(keys, r.ID)
+	}
+
+	if err := db.List(&Record{}); err == nil {
+		t.Fatal("expected error listing into a non-slice")
+	}
+}
+
+// writeRecords writes n records and returns the set of their keys
+func writeRecords(t *testing.T, db store.Store, n int) map[string]bool {
+	keys := make(map[string]bool)
+	for y := 0; y < n; y++ {
+		r := newRecord("page", y)
+		if err := db.Write(r); err != nil {
+			t.Fatal("err", err)
+		}
+		keys[r.Key()] = true
+	}
+	return keys
+}
+
+func testListPage(t *testing.T, factory func() store.Store) {
+	db := factory()
+	pager, ok := db.(store.Pager)
+	if !ok {
+		t.Skip("store does not implement store.Pager")
+	}
+	keys := writeRecords(t, db, 25)
+
+	var page []Record
+	var cursor string
+	// pages have at least one id, except the last
+	for pages := 0; ; pages++ {
+		if pages > 25 {
+			t.Fatal("expected ListPage to end")
+		}
+		next, err := pager.ListPage(&page, cursor, 10)
+		if err != nil {
+			t.Fatal("err", err)
+		}
+		for _, r := range page {
+			if !keys[r.ID] {
+				t.Fatal("unexpected or repeated key in page: ", r.ID)
+			}
+			delete(keys, r.ID)
+		}
+		if cursor = next; len(cursor) == 0 {
+			break
+		}
+	}
+	if len(keys) != 0 {
+		t.Fatal("expected all keys to be listed, missing: ", len(keys))
+	}
+}
+
+// lister hides the methods of a store other than List
+type lister struct {
+	store.Lister
+}
+
+func testIterate(t *testing.T, factory func() store.Store) {
+	db := factory()
+	keys := writeRecords(t, db, 25)
+
+	for _, l := range []store.Lister{db, lister{db}} {
+		seen := make(map[string]bool)
+		it := store.Iterate(l, &Record{}, 10)
+		for it.Next() {
+			r, ok := it.Item().(*Record)
+			if !ok || !keys[r.ID] || seen[r.ID] {
+				t.Fatal("unexpected or repeated item: ", it.Item())
+			}
+			seen[r.ID] = true
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal("err", err)
+		}
+		if err := it.Close(); err != nil {
+			t.Fatal("err", err)
+		}
+		if len(seen) != len(keys) {
+			t.Fatalf("expected %d items, got: %d", len(keys), len(seen))
+		}
+	}
+
+	it := store.Iterate(db, &Record{}, 10)
+	if !it.Next() {
+		t.Fatal("expected an item, got: ", it.Err())
+	}
+	it.Close()
+	if it.Next() {
+		t.Fatal("expected Next to return false after Close")
+	}
+	// iterations stopped after a page are resumed from its cursor
+	seen := make(map[string]bool)
+	it = store.Iterate(db, &Record{}, 10)
+	var cursor string
+	for it.Next() {
+		if len(seen) == 0 {
+			cursor = it.Cursor()
+		}
+		if it.Cursor() != cursor {
+			break
+		}
+		seen[it.Item().Key()] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal("err", err)
+	}
+	// stores returning a single page have no page to resume from
+	if len(cursor) != 0 {
+		it = store.IterateFrom(db, &Record{}, cursor, 10)
+		for it.Next() {
+			if seen[it.Item().Key()] {
+				t.Fatal("repeated item after resuming: ", it.Item().Key())
+			}
+			seen[it.Item().Key()] = true
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal("err", err)
+		}
+	}
+	if len(seen) != len(keys) {
+		t.Fatalf("expected %d items, got: %d", len(keys), len(seen))
+	}
+
+	it = store.IterateFrom(lister{db}, &Record{}, "cursor", 10)
+	if it.Next() || it.Err() != store.ErrInvalidCursor {
+		t.Fatal("expected ErrInvalidCursor, got: ", it.Err())
+	}
+}
+
+func testCount(t *testing.T, factory func() store.Store) {
+	db := factory()
+	counter, ok := db.(store.Counter)
+	if !ok {
+		t.Skip("store does not implement store.Counter")
+	}
+	if n, err := counter.Count(&Record{}); err != nil || n != 0 {
+		t.Fatal("expected 0 items, got: ", n, err)
+	}
+	writeRecords(t, db, 5)
+	if err := db.Write(&Other{Field: "other"}); err != nil {
+		t.Fatal("err", err)
+	}
+	for _, sample := range []interface{}{&Record{}, []Record{}, &[]Record{}} {
+		if n, err := counter.Count(sample); err != nil || n != 5 {
+			t.Fatalf("%T: expected 5 items, got: %d %v", sample, n, err)
+		}
+	}
+	// expired items are not counted
+	expiring := &Session{User: "ada", ttl: 10 * time.Millisecond}
+	if err := db.WriteMultiple([]store.Item{expiring, &Session{User: "alan"}}); err != nil {
+		t.Fatal("err", err)
+	}
+	eventually(t, 5*time.Second, func() error {
+		if n, err := counter.Count(&Session{}); err != nil || n != 1 {
+			return fmt.Errorf("expected 1 item, got: %d %v", n, err)
+		}
+		return nil
+	})
+}
+
+func testExists(t *testing.T, factory func() store.Store) {
+	db := factory()
+	exister, ok := db.(store.Exister)
+	if !ok {
+		t.Skip("store does not implement store.Exister")
+	}
+	r := newRecord("exists", 1)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if ok, err := exister.Exists(&Record{ID: r.Key()}); err != nil || !ok {
+		t.Fatal("expected the item to exist, got: ", ok, err)
+	}
+	if ok, err := exister.Exists(&Other{ID: r.Key()}); err != nil || ok {
+		t.Fatal("expected an item of another type not to exist, got: ", ok, err)
+	}
+	if _, err := exister.Exists(&Record{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+	got, err := exister.ExistsMultiple([]store.Item{&Record{ID: "missing"}, r})
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []bool{false, true}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %v \ngot: %v", exp, got)
+	}
+}
+
+func testTypeIsolation(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r := newRecord("value", 12)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Read(&Other{ID: r.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound for another type, got: ", err)
+	}
+
+	var others []Other
+	if err := db.List(&others); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(others) != 0 {
+		t.Fatal("expected no items of another type, got: ", len(others))
+	}
+}
+
+func testCollection(t *testing.T, factory func() store.Store) {
+	db := factory()
+	r := newRecord("shared", 1)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &RecordView{ID: r.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := (RecordView{ID: r.Key(), Field: "shared"}); *got != exp {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+	var views []RecordView
+	if err := db.List(&views); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(views) != 1 || views[0].ID != r.Key() {
+		t.Fatalf("expected the record, got: %#v", views)
+	}
+
+	// items of unnamed types have no collection
+	unnamed := &struct{ Record }{}
+	if err := db.Write(unnamed); err != store.ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got: ", err)
+	}
+	unnamed.ID = r.Key()
+	if err := db.Read(unnamed); err != store.ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got: ", err)
+	}
+	if err := db.Delete(unnamed); err != store.ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got: ", err)
+	}
+	var list []struct{ Record }
+	if err := db.List(&list); err != store.ErrEmptyCollection {
+		t.Fatal("expected ErrEmptyCollection, got: ", err)
+	}
+}
+
+func testNamespaceIsolation(t *testing.T, factory func() store.Store) {
+	db, other := factory(), factory()
+	r := newRecord("value", 13)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := other.Read(&Record{ID: r.Key()}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound in another store, got: ", err)
+	}
+}
+
+func testKeys(t *testing.T, factory func() store.Store) {
+	db := factory()
+	keys := []string{"a:b", "a:b:", ":", "a*", "a?[b]", `a\b`, "100%", "%3A", "ключ"}
+	var items []store.Item
+	for n, key := range keys {
+		r := newRecord(key, n)
+		r.ID = key
+		items = append(items, r)
+	}
+	if err := db.WriteMultiple(items); err != nil {
+		t.Fatal("err", err)
+	}
+	for n, key := range keys {
+		got := &Record{ID: key}
+		if err := db.Read(got); err != nil {
+			t.Fatalf("read %q: %v", key, err)
+		}
+		if exp := public(items[n].(*Record)); !reflect.DeepEqual(*got, exp) {
+			t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+		}
+	}
+	if err := db.Read(&Record{ID: "a"}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+
+	var list []Record
+	if err := db.List(&list); err != nil {
+		t.Fatal("err", err)
+	}
+	var got []string
+	for _, r := range list {
+		got = append(got, r.ID)
+	}
+	sort.Strings(got)
+	exp := append([]string(nil), keys...)
+	sort.Strings(exp)
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %q \ngot: %q", exp, got)
+	}
+
+	if err := db.Delete(&Record{ID: "a:b"}); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Read(&Record{ID: "a:b:"}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	for _, key := range []string{"a\nb", "\x00", "\xff"} {
+		if err := db.Write(&Record{ID: key}); err != store.ErrInvalidKey {
+			t.Fatalf("write %q: expected ErrInvalidKey, got: %v", key, err)
+		}
+		if err := db.Read(&Record{ID: key}); err != store.ErrInvalidKey {
+			t.Fatalf("read %q: expected ErrInvalidKey, got: %v", key, err)
+		}
+		checkItemErrors(t, db.ReadMultiple([]Record{{ID: key}}), map[int]error{0: store.ErrInvalidKey})
+		if err := db.Delete(&Record{ID: key}); err != store.ErrInvalidKey {
+			t.Fatalf("delete %q: expected ErrInvalidKey, got: %v", key, err)
+		}
+		_, err := db.DeleteMultiple([]store.Item{&Record{ID: key}})
+		checkItemErrors(t, err, map[int]error{0: store.ErrInvalidKey})
+	}
+}
+
+func testFinder(t *testing.T, factory func() store.Store) {
+	db := factory()
+	finder, ok := db.(store.Finder)
+	if !ok {
+		t.Skip("store does not implement store.Finder")
+	}
+
+	ada := &Indexed{Name: "ada", Age: 36, Score: 1.5}
+	alan := &Indexed{Name: "alan", Age: 41, Score: 2.5}
+	grace := &Indexed{Name: "grace", Age: 85, Score: 3.5}
+	if err := db.WriteMultiple([]store.Item{ada, alan, grace}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	var got []Indexed
+	if err := finder.FindBy("Name", "alan", &got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []Indexed{*alan}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+	if err := finder.FindBy("Age", 85, &got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []Indexed{*grace}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+	if err := finder.FindRange("Score", 1, 3, &got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := []Indexed{*ada, *alan}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, got)
+	}
+
+	// overwriting and deleting items updates the indexes
+	alan.Name = "turing"
+	if err := db.Write(alan); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := finder.FindBy("Name", "alan", &got); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(got) != 0 {
+		t.Fatal("expected no items for the overwritten value, got: ", len(got))
+	}
+	if err := db.Delete(grace); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := finder.FindRange("Age", 80, 90, &got); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(got) != 0 {
+		t.Fatal("expected no items for the deleted item, got: ", len(got))
+	}
+
+	if err := finder.FindBy("Note", "", &got); err != store.ErrNotIndexed {
+		t.Fatal("expected ErrNotIndexed, got: ", err)
+	}
+	if err := finder.FindRange("Name", 0, 1, &got); err != store.ErrNotIndexed {
+		t.Fatal("expected ErrNotIndexed, got: ", err)
+	}
+}
+
+func testExpiry(t *testing.T, factory func() store.Store) {
+	db := factory()
+	// long enough for the item to be read before it expires on slow
+	// machines
+	ttl := time.Second
+	expiring := &Session{User: "ada", ttl: ttl}
+	lasting := &Session{User: "alan"}
+	if err := db.WriteMultiple([]store.Item{expiring, lasting}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	got := &Session{ID: expiring.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.TTL() <= 0 || got.TTL() > ttl {
+		t.Fatalf("expected TTL between 0 and %v, got: %v", ttl, got.TTL())
+	}
+	got = &Session{ID: lasting.Key(), ttl: time.Hour}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got.TTL() != 0 {
+		t.Fatal("expected no TTL, got: ", got.TTL())
+	}
+
+	eventually(t, 10*ttl, func() error {
+		if err := db.Read(&Session{ID: expiring.Key()}); err != store.ErrKeyNotFound {
+			return fmt.Errorf("expected ErrKeyNotFound after expiry, got: %v", err)
+		}
+		return nil
+	})
+	var sessions []Session
+	if err := db.List(&sessions); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != lasting.Key() {
+		t.Fatalf("expected only %s to be listed, got: %#v", lasting.Key(), sessions)
+	}
+}
+
+func testVersioning(t *testing.T, factory func() store.Store) {
+	db := factory()
+	acct := &Account{Balance: 10}
+	if err := db.Write(acct); err != nil {
+		t.Fatal("err", err)
+	}
+	if acct.Version() != 1 {
+		t.Fatal("expected version 1 after the first write, got: ", acct.Version())
+	}
+
+	first, second := &Account{ID: acct.Key()}, &Account{ID: acct.Key()}
+	if err := db.Read(first); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := db.Read(second); err != nil {
+		t.Fatal("err", err)
+	}
+	if first.Version() != 1 {
+		t.Fatal("expected Read to set version 1, got: ", first.Version())
+	}
+
+	first.Balance = 20
+	if err := db.Write(first); err != nil {
+		t.Fatal("err", err)
+	}
+	second.Balance = 30
+	if err := db.Write(second); err != store.ErrConflict {
+		t.Fatal("expected ErrConflict writing a stale version, got: ", err)
+	}
+	err := db.WriteMultiple([]store.Item{&Record{}, second})
+	checkItemErrors(t, err, map[int]error{1: store.ErrConflict})
+
+	got := []Account{{ID: acct.Key()}}
+	if err := db.ReadMultiple(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if got[0].Balance != 20 || got[0].Version() != 2 {
+		t.Fatalf("expected balance 20 at version 2, got: %d at version %d", got[0].Balance, got[0].Version())
+	}
+
+	if err := db.Write(&Account{ID: "new-account", version: 3}); err != store.ErrConflict {
+		t.Fatal("expected ErrConflict writing a new item with a version, got: ", err)
+	}
+}
+
+func testPatch(t *testing.T, factory func() store.Store) {
+	db := factory()
+	patcher, ok := db.(store.Patcher)
+	if !ok {
+		t.Skip("store does not implement store.Patcher")
+	}
+
+	if err := patcher.Patch(&Record{ID: "missing"}); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := patcher.Patch(&Record{}); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+
+	r := newRecord("value", 14)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	r.Field = "patched"
+	if err := patcher.Patch(r); err != nil {
+		t.Fatal("err", err)
+	}
+	got := &Record{ID: r.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	if exp := public(r); !reflect.DeepEqual(*got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+}
+
+func testUpdater(t *testing.T, factory func() store.Store) {
+	db := factory()
+	updater, ok := db.(store.Updater)
+	if !ok {
+		t.Skip("store does not implement store.Updater")
+	}
+
+	fields := map[string]interface{}{"Field": "updated"}
+	if err := updater.UpdateFields(&Record{ID: "missing"}, fields); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+	if err := updater.UpdateFields(&Record{}, fields); err != store.ErrEmptyKey {
+		t.Fatal("expected ErrEmptyKey, got: ", err)
+	}
+	if _, err := updater.Increment(&Record{ID: "missing"}, "FieldInt", 1); err != store.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got: ", err)
+	}
+
+	r := newRecord("value", 14)
+	if err := db.Write(r); err != nil {
+		t.Fatal("err", err)
+	}
+	if err := updater.UpdateFields(r, map[string]interface{}{"Unknown": 1}); err != store.ErrUnknownField {
+		t.Fatal("expected ErrUnknownField, got: ", err)
+	}
+	if err := updater.UpdateFields(r, map[string]interface{}{"Field": "updated", "FieldBool": false}); err != nil {
+		t.Fatal("err", err)
+	}
+	n, err := updater.Increment(r, "FieldInt", 3)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if n != -11 {
+		t.Fatal("expected -11, got: ", n)
+	}
+	f, err := updater.IncrementFloat(r, "FieldFloat", 0.5)
+	if err != nil {
+		t.Fatal("err", err)
+	}
+	if f != 18 {
+		t.Fatal("expected 18, got: ", f)
+	}
+	if _, err := updater.Increment(r, "Field", 1); err == nil {
+		t.Fatal("expected error incrementing a string field")
+	}
+
+	got := &Record{ID: r.Key()}
+	if err := db.Read(got); err != nil {
+		t.Fatal("err", err)
+	}
+	exp := public(r)
+	exp.Field, exp.FieldBool, exp.FieldInt, exp.FieldFloat = "updated", false, -11, 18
+	if !reflect.DeepEqual(*got, exp) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", exp, *got)
+	}
+
+	// pointer fields are incremented as the values they point to, results
+	// overflowing the type of the field are not stored
+	hits, ratio := 1, float32(0.5)
+	counter := &Counter{ID: "counter", Hits: &hits, Small: 120, Ratio: &ratio}
+	if err := db.Write(counter); err != nil {
+		t.Fatal("err", err)
+	}
+	if n, err := updater.Increment(counter, "Hits", 2); err != nil || n != 3 {
+		t.Fatal("expected 3, got: ", n, err)
+	}
+	if f, err := updater.IncrementFloat(counter, "Ratio", 1); err != nil || f != 1.5 {
+		t.Fatal("expected 1.5, got: ", f, err)
+	}
+	if n, err := updater.Increment(counter, "Small", 7); err != nil || n != 127 {
+		t.Fatal("expected 127, got: ", n, err)
+	}
+	if _, err := updater.Increment(counter, "Small", 1); err == nil {
+		t.Fatal("expected error overflowing an int8 field")
+	}
+	if _, err := updater.IncrementFloat(counter, "Ratio", math.MaxFloat64); err == nil {
+		t.Fatal("expected error overflowing a float32 field")
+	}
+	gotCounter := &Counter{ID: "counter"}
+	if err := db.Read(gotCounter); err != nil {
+		t.Fatal("err", err)
+	}
+	hits, ratio = 3, 1.5
+	if expCounter := (&Counter{ID: "counter", Hits: &hits, Small: 127, Ratio: &ratio}); !reflect.DeepEqual(gotCounter, expCounter) {
+		t.Fatalf("Mismatch\nexp: %#v \ngot: %#v", expCounter, gotCounter)
+	}
+}
+
+func testListSorted(t *testing.T, factory func() store.Store) {
+	db := factory()
+	lister, ok := db.(store.SortedLister)
+	if !ok {
+		t.Skip("store does not implement store.SortedLister")
+	}
+
+	// written in distinct milliseconds so that stores keeping the
+	// creation time in milliseconds order them
+	for _, x := range []*Indexed{
+		{ID: "c", Age: 41, Score: 2.5},
+		{ID: "a", Age: 85, Score: 1.5},
+		{ID: "d", Age: 36, Score: 2.5},
+		{ID: "b", Age: 60},
+	} {
+		if err := db.Write(x); err != nil {
+			t.Fatal("err", err)
+		}
+		nextMillisecond()
+	}
+	// written again, it keeps its creation time
+	if err := db.Write(&Indexed{ID: "c", Age: 50, Score: 2.5}); err != nil {
+		t.Fatal("err", err)
+	}
+
+	tests := []struct {
+		by  store.Sort
+		exp []string
+	}{
+		{store.Sort{Field: "Age"}, []string{"d", "c", "b", "a"}},
+		{store.Sort{Field: "Age", Descending: true}, []string{"a", "b", "c", "d"}},
+		{store.Sort{Field: "Age", Offset: 1, Limit: 2}, []string{"c", "b"}},
+		{store.Sort{Field: "Age", Offset: 3, Limit: 2}, []string{"a"}},
+		{store.Sort{Field: "Age", Offset: 5}, []string{}},
+		{store.Sort{Field: "Score"}, []string{"b", "a", "c", "d"}},
+		{store.Sort{Field: "Score", Descending: true}, []string{"d", "c", "a", "b"}},
+		{store.Sort{}, []string{"c", "a", "d", "b"}},
+		{store.Sort{Descending: true, Limit: 3}, []string{"b", "d", "a"}},
+	}
+	for _, tt := range tests {
+		var got []Indexed
+		if err := lister.ListSorted(&got, tt.by); err != nil {
+			t.Fatalf("%+v: %v", tt.by, err)
+		}
+		keys := []string{}
+		for _, x := range got {
+			keys = append(keys, x.ID)
+		}
+		if !reflect.DeepEqual(keys, tt.exp) {
+			t.Fatalf("%+v: expected %v, got: %v", tt.by, tt.exp, keys)
+		}
+	}
+
+	// time fields are ordered by time
+	at := time.Date(2015, 10, 18, 9, 30, 0, 0, time.UTC)
+	orders := []store.Item{
+		&Order{ID: "first", CreatedAt: at},
+		&Order{ID: "last", CreatedAt: at.Add(time.Hour)},
+		&Order{ID: "second", CreatedAt: at.Add(time.Nanosecond * 1000)},
+	}
+	if err := db.WriteMultiple(orders); err != nil {
+		t.Fatal("err", err)
+	}
+	var latest []Order
+	if err := lister.ListSorted(&latest, store.Sort{Field: "CreatedAt", Descending: true, Limit: 2}); err != nil {
+		t.Fatal("err", err)
+	}
+	if len(latest) != 2 || latest[0].ID != "last" || latest[1].ID != "second" {
+		t.Fatalf("expected the latest orders, got: %v", latest)
+	}
+
+	var got []Indexed
+	if err := lister.ListSorted(&got, store.Sort{Field: "Name"}); err != store.ErrNotIndexed {
+		t.Fatal("expected ErrNotIndexed for a field that is not numeric, got: ", err)
+	}
+	if err := lister.ListSorted(&got, store.Sort{Field: "Note"}); err != store.ErrNotIndexed {
+		t.Fatal("expected ErrNotIndexed for a field that is not indexed, got: ", err)
+	}
+}
+
+// eventually is a helper function that calls cond until it returns nil,
+// failing the test with the last error returned when it doesn't within
+// timeout
+func eventually(t *testing.T, timeout time.Duration, cond func() error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := cond()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// nextMillisecond is a helper function that waits until the wall clock
+// reaches the next millisecond
+func nextMillisecond() {
+	// truncating drops the monotonic clock reading, the times are
+	// compared by wall clock like the creation times of stores
+	now := time.Now().Truncate(time.Millisecond)
+	for !time.Now().Truncate(time.Millisecond).After(now) {
+		time.Sleep(100 * time.Microsecond)
+	}
+}